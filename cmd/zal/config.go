@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/config"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// overrides decides which flags override values from the config file.
+// Without config file every flag, including its default, is used.
+type overrides struct {
+	all bool
+	set map[string]bool
+}
+
+// loadConfig loads the config file if path is set, otherwise returns default config.
+func loadConfig(app *kingpin.Application, args []string, path string) (*config.Config, overrides, error) {
+	if path == "" {
+		return config.Default(), overrides{all: true}, nil
+	}
+
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return nil, overrides{}, err
+	}
+
+	return cfg, overrides{set: flagsSetByUser(app, args)}, nil
+}
+
+// flagsSetByUser returns names of the flags which were set on the command line or through environment variables.
+func flagsSetByUser(app *kingpin.Application, args []string) map[string]bool {
+	set := map[string]bool{}
+
+	ctx, err := app.ParseContext(args)
+	if err != nil {
+		return set
+	}
+
+	// flags of parent commands apply to their subcommands
+	flags := app.Model().Flags
+	for _, e := range ctx.Elements {
+		if c, ok := e.Clause.(*kingpin.CmdClause); ok && c != ctx.SelectedCommand {
+			flags = append(flags, c.Model().Flags...)
+		}
+	}
+	if ctx.SelectedCommand != nil {
+		flags = append(flags, ctx.SelectedCommand.Model().Flags...)
+	}
+
+	for _, f := range flags {
+		if f.Envar == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(f.Envar); ok {
+			set[f.Name] = true
+		}
+	}
+
+	for _, e := range ctx.Elements {
+		if f, ok := e.Clause.(*kingpin.FlagClause); ok {
+			set[f.Model().Name] = true
+		}
+	}
+
+	return set
+}
+
+func (o overrides) String(name string, dst *string, v string) {
+	if o.all || o.set[name] {
+		*dst = v
+	}
+}
+
+func (o overrides) Int(name string, dst *int, v int) {
+	if o.all || o.set[name] {
+		*dst = v
+	}
+}
+
+func (o overrides) Int64(name string, dst *int64, v int64) {
+	if o.all || o.set[name] {
+		*dst = v
+	}
+}
+
+func (o overrides) Bool(name string, dst *bool, v bool) {
+	if o.all || o.set[name] {
+		*dst = v
+	}
+}
+
+func (o overrides) Duration(name string, dst *time.Duration, v time.Duration) {
+	if o.all || o.set[name] {
+		*dst = v
+	}
+}
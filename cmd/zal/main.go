@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/devopyio/zabbix-alertmanager/tracing"
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/bridge"
+	"github.com/devopyio/zabbix-alertmanager/zabbixexporter/exporter"
 	"github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/provisioner"
 	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
 	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
@@ -27,18 +33,96 @@ func main() {
 
 	send := app.Command("send", "Listens for Alert requests from Alertmanager and sends them to Zabbix.")
 	senderAddr := send.Flag("addr", "Server address which will receive alerts from alertmanager.").Default("0.0.0.0:9095").String()
-	zabbixAddr := send.Flag("zabbix-addr", "Zabbix address.").Envar("ZABBIX_URL").Required().String()
+	zabbixAddr := send.Flag("zabbix-addr", "Zabbix address.").Envar("ZABBIX_URL").String()
 	hostsFile := send.Flag("hosts-path", "Path to resolver to host mapping file.").String()
 	keyPrefix := send.Flag("key-prefix", "Prefix to add to the trapper item key").Default("prometheus").String()
 	defaultHost := send.Flag("default-host", "default host to send alerts to").Default("prometheus").String()
+	retries := send.Flag("retries", "Number of times a send is retried when Zabbix can't be reached.").Default("0").Int()
+	retryBackoff := send.Flag("retry-backoff", "Time to wait between retries.").Default("1s").Duration()
+	tlsCertFile := send.Flag("tls-cert-file", "Path to TLS certificate, enables HTTPS.").String()
+	tlsKeyFile := send.Flag("tls-key-file", "Path to TLS certificate key.").String()
+	alertsAPIReceiver := send.Flag("alerts-api-receiver", "Receiver used to route alerts pushed by Prometheus to /api/v2/alerts.").Default("prometheus").String()
+	alertsAPIResolveTimeout := send.Flag("alerts-api-resolve-timeout", "Time after which alerts pushed by Prometheus without endsAt are resolved.").Default("5m").Duration()
+	dryRun := send.Flag("dry-run", "Log and record metrics instead of sending them to Zabbix.").Bool()
+	capturePath := send.Flag("capture-path", "Path to file where received requests are captured, disabled if empty.").String()
+	captureMaxSize := send.Flag("capture-max-size", "Size at which the capture file is rotated.").Default("100MB").Bytes()
+	captureMaxFiles := send.Flag("capture-max-files", "Number of rotated capture files to keep.").Default("5").Int()
+	tracingExporter := send.Flag("tracing-exporter", "OpenTelemetry span exporter, otlp or stdout, disabled if empty.").String()
+	tracingEndpoint := send.Flag("tracing-endpoint", "OTLP http collector address, defaults to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318.").String()
+	tracingInsecure := send.Flag("tracing-insecure", "Send spans to the OTLP collector over plain http.").Bool()
+	bisectRejected := send.Flag("bisect-rejected", "Find metrics rejected by Zabbix by splitting the packet, requests with only rejected metrics succeed.").Bool()
+	async := send.Flag("async", "Answer alert requests with 202 once queued and send them to Zabbix in the background.").Bool()
+	asyncQueueSize := send.Flag("async-queue-size", "Maximum number of queued Zabbix sends, requests are rejected with 429 when full.").Default("1000").Int()
+	asyncWorkers := send.Flag("async-workers", "Number of concurrent Zabbix sends in async mode.").Default("4").Int()
+	dedupeWindow := send.Flag("dedupe-window", "Time an Alertmanager notification is remembered, so copies from other cluster members and retries are sent once, 0 disables it.").Default("0").Duration()
+	sampleAnnotation := send.Flag("sample-annotation", "Annotation holding the alert sample value sent to a float item, disabled if empty.").String()
+	sampleLabel := send.Flag("sample-label", "Label holding the sample value of alerts without the sample annotation.").String()
+	statusRequests := send.Flag("status-requests", "Number of recent requests shown on the status page "+zabbixsvc.StatusPath+".").Default("100").Int()
+	testToken := send.Flag("test-token", "Bearer token of the synthetic alert endpoint "+zabbixsvc.TestPath+", disabled if empty.").Envar("ZAL_TEST_TOKEN").String()
+
+	sendServe := send.Command("serve", "Listens for Alert requests and sends them to Zabbix.").Default()
+	sendTest := send.Command("test", "Sends a synthetic firing alert and then resolves it, and prints both Zabbix responses.")
+	sendTestHost := sendTest.Flag("host", "Zabbix host of the synthetic alert, defaults to the default host.").String()
+	sendTestKey := sendTest.Flag("key", "Item key of the synthetic alert, defaults to the key of "+zabbixsvc.TestAlertName+".").String()
+	sendTestDelay := sendTest.Flag("delay", "Time between the firing and the resolved value.").Default(zabbixsvc.DefaultTestDelay.String()).Duration()
+
+	replay := app.Command("replay", "Replays requests captured by zal send.")
+	replayFile := replay.Flag("file", "Path to capture file.").Required().ExistingFile()
+	replayDryRun := replay.Flag("dry-run", "Print metrics instead of sending them to Zabbix.").Bool()
+	replayZabbixAddr := replay.Flag("zabbix-addr", "Zabbix address.").Envar("ZABBIX_URL").String()
+	replayHostsFile := replay.Flag("hosts-path", "Path to resolver to host mapping file.").String()
+	replayKeyPrefix := replay.Flag("key-prefix", "Prefix to add to the trapper item key").Default("prometheus").String()
+	replayDefaultHost := replay.Flag("default-host", "default host to send alerts to").Default("prometheus").String()
 
 	prov := app.Command("prov", "Reads Prometheus Alerting rules and converts them into Zabbix Triggers.")
-	provConfig := prov.Flag("config-path", "Path to provisioner hosts config file.").Required().String()
-	provUser := prov.Flag("user", "Zabbix json rpc user.").Envar("ZABBIX_USER").Required().String()
-	provPassword := prov.Flag("password", "Zabbix json rpc password.").Envar("ZABBIX_PASSWORD").Required().String()
+	provConfig := prov.Flag("config-path", "Path to provisioner hosts config file.").String()
+	provUser := prov.Flag("user", "Zabbix json rpc user.").Envar("ZABBIX_USER").String()
+	provPassword := prov.Flag("password", "Zabbix json rpc password.").Envar("ZABBIX_PASSWORD").String()
 	provURL := prov.Flag("url", "Zabbix json rpc url.").Envar("ZABBIX_URL").Default("http://127.0.0.1/zabbix/api_jsonrpc.php").String()
 	provKeyPrefix := prov.Flag("key-prefix", "Prefix to add to the trapper item key.").Default("prometheus").String()
 	prometheusURL := prov.Flag("prometheus-url", "Prometheus URL.").Default("").String()
+	provTLSCAFile := prov.Flag("tls-ca-file", "Path to CA certificate used to verify Zabbix json rpc url.").String()
+	provTLSInsecure := prov.Flag("tls-insecure-skip-verify", "Don't verify Zabbix json rpc url certificate.").Bool()
+	provSampleAnnotation := prov.Flag("sample-annotation", "Float items are created for rules with this annotation, disabled if empty.").String()
+	provSampleLabel := prov.Flag("sample-label", "Float items are created for rules with this label.").String()
+
+	bridgeCmd := app.Command("bridge", "Syncs Zabbix problem acknowledgements and maintenances with Alertmanager silences.")
+	bridgeAlertmanagerURL := bridgeCmd.Flag("alertmanager-url", "Alertmanager URL.").Default("http://127.0.0.1:9093").String()
+	bridgeInterval := bridgeCmd.Flag("interval", "Time between syncs.").Default("1m").Duration()
+	bridgeAckSilenceDuration := bridgeCmd.Flag("ack-silence-duration", "Duration of silences created for acknowledged problems, 0 disables them.").Default("2h").Duration()
+	bridgeHostLabel := bridgeCmd.Flag("host-label", "Alert label holding the Zabbix host name, silences match it to silence alerts of one host.").String()
+	bridgeGlobalSilences := bridgeCmd.Flag("global-silences", "Allow silences without host label, which silence alertnames on all hosts.").Bool()
+	bridgeMaintenanceSilences := bridgeCmd.Flag("maintenance-silences", "Silence alerts of hosts in Zabbix maintenance.").Default("true").Bool()
+	bridgeSilenceMaintenances := bridgeCmd.Flag("silence-maintenances", "Create Zabbix maintenances for Alertmanager silences of zal managed triggers.").Bool()
+	bridgeTimezone := bridgeCmd.Flag("timezone", "Zabbix server time zone used to evaluate maintenance periods, defaults to local time zone.").String()
+	bridgeUser := bridgeCmd.Flag("user", "Zabbix json rpc user.").Envar("ZABBIX_USER").String()
+	bridgePassword := bridgeCmd.Flag("password", "Zabbix json rpc password.").Envar("ZABBIX_PASSWORD").String()
+	bridgeURL := bridgeCmd.Flag("url", "Zabbix json rpc url.").Envar("ZABBIX_URL").Default("http://127.0.0.1/zabbix/api_jsonrpc.php").String()
+	bridgeKeyPrefix := bridgeCmd.Flag("key-prefix", "Prefix of the trapper item keys.").Default("prometheus").String()
+	bridgeHosts := bridgeCmd.Flag("host", "Zal managed Zabbix host, repeatable. Defaults to hosts from the config file.").Strings()
+	bridgeMetricsAddr := bridgeCmd.Flag("addr", "Server address which exposes metrics.").Default("0.0.0.0:9096").String()
+
+	pullCmd := app.Command("pull", "Forwards Zabbix problems to Alertmanager as alerts.")
+	pullAlertmanagerURL := pullCmd.Flag("alertmanager-url", "Alertmanager URL.").Default("http://127.0.0.1:9093").String()
+	pullInterval := pullCmd.Flag("interval", "Time between syncs.").Default("1m").Duration()
+	pullResolveTimeout := pullCmd.Flag("resolve-timeout", "Alerts end unless refreshed by a sync, must be longer than interval.").Default("5m").Duration()
+	pullHostGroups := pullCmd.Flag("host-group", "Pull problems of hosts of the Zabbix host group, repeatable. Defaults to all hosts.").Strings()
+	pullUser := pullCmd.Flag("user", "Zabbix json rpc user.").Envar("ZABBIX_USER").String()
+	pullPassword := pullCmd.Flag("password", "Zabbix json rpc password.").Envar("ZABBIX_PASSWORD").String()
+	pullURL := pullCmd.Flag("url", "Zabbix json rpc url.").Envar("ZABBIX_URL").Default("http://127.0.0.1/zabbix/api_jsonrpc.php").String()
+	pullKeyPrefix := pullCmd.Flag("key-prefix", "Prefix of the trapper item keys, problems of zal managed triggers are not pulled.").Default("prometheus").String()
+	pullMetricsAddr := pullCmd.Flag("addr", "Server address which exposes metrics.").Default("0.0.0.0:9097").String()
+
+	exporterCmd := app.Command("exporter", "Exposes Zabbix trigger, problem and item state as Prometheus metrics.")
+	exporterAddr := exporterCmd.Flag("addr", "Server address which exposes metrics.").Default("0.0.0.0:9098").String()
+	exporterRefreshInterval := exporterCmd.Flag("refresh-interval", "Time between Zabbix api queries, scrapes are served from cache.").Default("1m").Duration()
+	exporterHosts := exporterCmd.Flag("host", "Export state of the Zabbix host, repeatable. Defaults to all monitored hosts.").Strings()
+	exporterUser := exporterCmd.Flag("user", "Zabbix json rpc user.").Envar("ZABBIX_USER").String()
+	exporterPassword := exporterCmd.Flag("password", "Zabbix json rpc password.").Envar("ZABBIX_PASSWORD").String()
+	exporterURL := exporterCmd.Flag("url", "Zabbix json rpc url.").Envar("ZABBIX_URL").Default("http://127.0.0.1/zabbix/api_jsonrpc.php").String()
+	exporterKeyPrefix := exporterCmd.Flag("key-prefix", "Prefix of the trapper item keys, values of zal managed items are exported.").Default("prometheus").String()
+
+	configFile := app.Flag("config.file", "Path to zal YAML config file. Flags set explicitly override config values.").String()
 
 	logLevel := app.Flag("log.level", "Log level.").
 		Default("info").Enum("error", "warn", "info", "debug")
@@ -47,6 +131,11 @@ func main() {
 
 	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
 
+	cfg, o, err := loadConfig(app, os.Args[1:], *configFile)
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+
 	switch strings.ToLower(*logLevel) {
 	case "error":
 		log.SetLevel(log.ErrorLevel)
@@ -69,44 +158,306 @@ func main() {
 	prometheus.MustRegister(ver.NewCollector("zal"))
 	prometheus.MustRegister(prommod.NewCollector("zal"))
 	switch cmd {
-	case send.FullCommand():
-		s, err := zabbixsnd.New(*zabbixAddr)
-		if err != nil {
-			log.Fatalf("error could not create zabbix sender: %v", err)
+	case sendServe.FullCommand(), sendTest.FullCommand():
+		if cmd == sendTest.FullCommand() {
+			// keep stdout for the result
+			log.SetOutput(os.Stderr)
 		}
 
-		hosts := make(map[string]string)
+		o.String("addr", &cfg.Send.ListenAddress, *senderAddr)
+		o.String("zabbix-addr", &cfg.Zabbix.Addr, *zabbixAddr)
+		o.String("key-prefix", &cfg.KeyPrefix, *keyPrefix)
+		o.String("default-host", &cfg.Send.DefaultHost, *defaultHost)
+		o.Int("retries", &cfg.Send.Retry.Retries, *retries)
+		o.Duration("retry-backoff", &cfg.Send.Retry.Backoff, *retryBackoff)
+		o.String("tls-cert-file", &cfg.Send.TLS.CertFile, *tlsCertFile)
+		o.String("tls-key-file", &cfg.Send.TLS.KeyFile, *tlsKeyFile)
+		o.String("tracing-exporter", &cfg.Send.Tracing.Exporter, *tracingExporter)
+		o.String("tracing-endpoint", &cfg.Send.Tracing.Endpoint, *tracingEndpoint)
+		o.Bool("tracing-insecure", &cfg.Send.Tracing.Insecure, *tracingInsecure)
+		o.Bool("bisect-rejected", &cfg.Send.BisectRejected, *bisectRejected)
+		o.Bool("async", &cfg.Send.Async.Enabled, *async)
+		o.Int("async-queue-size", &cfg.Send.Async.QueueSize, *asyncQueueSize)
+		o.Int("async-workers", &cfg.Send.Async.Workers, *asyncWorkers)
+		o.Duration("dedupe-window", &cfg.Send.DedupeWindow, *dedupeWindow)
+		o.String("sample-annotation", &cfg.Samples.Annotation, *sampleAnnotation)
+		o.String("sample-label", &cfg.Samples.Label, *sampleLabel)
+		o.String("test-token", &cfg.Send.TestToken, *testToken)
+		o.Bool("dry-run", &cfg.Send.DryRun, *dryRun)
+		o.String("capture-path", &cfg.Send.Capture.Path, *capturePath)
+		o.Int64("capture-max-size", &cfg.Send.Capture.MaxSize, int64(*captureMaxSize))
+		o.Int("capture-max-files", &cfg.Send.Capture.MaxFiles, *captureMaxFiles)
+		o.String("alerts-api-receiver", &cfg.Send.AlertsAPI.Receiver, *alertsAPIReceiver)
+		o.Duration("alerts-api-resolve-timeout", &cfg.Send.AlertsAPI.ResolveTimeout, *alertsAPIResolveTimeout)
+		o.Int("status-requests", &cfg.Send.StatusRequests, *statusRequests)
 
 		if hostsFile != nil && *hostsFile != "" {
-			hosts, err = zabbixsvc.LoadHostsFromFile(*hostsFile)
+			hosts, err := zabbixsvc.LoadHostsFromFile(*hostsFile)
 			if err != nil {
 				log.Errorf("cant load the default hosts file: %v", err)
+			} else {
+				cfg.Send.Routing = hosts
 			}
 		}
 
+		if err := cfg.ValidateSend(); err != nil {
+			log.Fatalf("error invalid configuration: %v", err)
+		}
+
+		s, err := zabbixsnd.New(cfg.Zabbix.Addr)
+		if err != nil {
+			log.Fatalf("error could not create zabbix sender: %v", err)
+		}
+
+		shutdownTracing, err := tracing.Setup(context.Background(), cfg.Send.Tracing, ver.Version)
+		if err != nil {
+			log.Fatalf("error could not set up tracing: %v", err)
+		}
+		defer shutdownTracing(context.Background())
+		if cfg.Send.Tracing.Exporter != "" {
+			log.Infof("exporting traces to %s", cfg.Send.Tracing.Exporter)
+		}
+
 		h := &zabbixsvc.JSONHandler{
-			Sender:      s,
-			KeyPrefix:   *keyPrefix,
-			DefaultHost: *defaultHost,
-			Hosts:       hosts,
+			Sender:         s,
+			KeyPrefix:      cfg.KeyPrefix,
+			Keys:           cfg.Keys,
+			DefaultHost:    cfg.Send.DefaultHost,
+			Hosts:          cfg.Send.Routing,
+			Encoding:       cfg.Send.ValueEncoding,
+			Encodings:      cfg.Send.ValueEncodings,
+			Samples:        cfg.Samples,
+			State:          zabbixsvc.NewState(),
+			Order:          zabbixsvc.NewOrder(),
+			DryRun:         cfg.Send.DryRun,
+			Retries:        cfg.Send.Retry.Retries,
+			RetryBackoff:   cfg.Send.Retry.Backoff,
+			BisectRejected: cfg.Send.BisectRejected,
+		}
+		if cfg.Send.DryRun {
+			log.Warn("dry run mode, metrics will not be sent to Zabbix")
+		}
+
+		if cmd == sendTest.FullCommand() {
+			result, err := h.Test(context.Background(), *sendTestHost, *sendTestKey, *sendTestDelay)
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(result); err != nil {
+				log.Errorf("error writing result: %v", err)
+			}
+
+			if err != nil {
+				log.Errorf("synthetic alert failed: %v", err)
+				shutdownTracing(context.Background())
+				os.Exit(1)
+			}
+			return
+		}
+
+		if cfg.Send.DedupeWindow > 0 {
+			h.Dedupe = zabbixsvc.NewDedupe(cfg.Send.DedupeWindow)
+			log.Infof("deduplicating alertmanager notifications, window: %s", cfg.Send.DedupeWindow)
+		}
+
+		// closing asyncStop sends the queued alerts, asyncDone is closed when they are sent
+		asyncStop, asyncDone := make(chan struct{}), make(chan struct{})
+		if cfg.Send.Async.Enabled {
+			h.Async = zabbixsvc.NewAsync(h, cfg.Send.Async)
+			go func() {
+				h.Async.Run(asyncStop)
+				close(asyncDone)
+			}()
+			log.Infof("sending alerts asynchronously, workers: %d, queue size: %d", cfg.Send.Async.Workers, cfg.Send.Async.QueueSize)
+		}
+
+		h.Requests = zabbixsvc.NewRequestLog(cfg.Send.StatusRequests)
+
+		alertsAPI := zabbixsvc.NewAlertsAPI(h, cfg.Send.AlertsAPI.Receiver, cfg.Send.AlertsAPI.ResolveTimeout)
+		go alertsAPI.Run(10*time.Second, make(chan struct{}))
+
+		wrap := func(f http.HandlerFunc) http.HandlerFunc { return f }
+		if cfg.Send.Capture.Path != "" {
+			c, err := zabbixsvc.NewCapture(cfg.Send.Capture.Path, cfg.Send.Capture.MaxSize, cfg.Send.Capture.MaxFiles)
+			if err != nil {
+				log.Fatalf("error could not create capture file: %v", err)
+			}
+			defer c.Close()
+
+			wrap = c.Wrap
+			log.Infof("capturing requests to '%s'", cfg.Send.Capture.Path)
 		}
 
 		http.Handle("/metrics", promhttp.Handler())
-		http.HandleFunc("/alerts", h.HandlePost)
+		http.HandleFunc("/alerts", wrap(h.HandlePost))
+		http.HandleFunc("/grafana", wrap(h.HandleGrafana))
+		http.HandleFunc(zabbixsvc.AlertsAPIPath, wrap(h.Requests.Wrap(cfg.Send.AlertsAPI.Receiver, alertsAPI.HandlePost)))
 
-		log.Info("Zabbix sender started, listening on ", *senderAddr)
-		if err := http.ListenAndServe(*senderAddr, nil); err != nil {
-			log.Fatal(err)
+		if cfg.Send.PathRouting.Enabled() {
+			pathRouting, err := zabbixsvc.NewPathRouting(h, cfg.Send.PathRouting)
+			if err != nil {
+				log.Fatalf("error invalid path routing config: %v", err)
+			}
+			http.HandleFunc(zabbixsvc.PathRoutingPath, wrap(pathRouting.HandlePost))
+			log.Infof("routing alerts by host in '%s{host}'", zabbixsvc.PathRoutingPath)
+		}
+
+		for _, webhookConfig := range cfg.Send.Webhooks {
+			webhook, err := zabbixsvc.NewWebhook(h, webhookConfig)
+			if err != nil {
+				log.Fatalf("error invalid webhook %s: %v", webhookConfig.Path, err)
+			}
+			http.HandleFunc(webhookConfig.Path, wrap(webhook.HandlePost))
+			log.Infof("serving webhook on '%s'", webhookConfig.Path)
+		}
+
+		if len(cfg.Send.RemoteWrite.Series) != 0 {
+			remoteWrite, err := zabbixsvc.NewRemoteWrite(h, cfg.Send.RemoteWrite)
+			if err != nil {
+				log.Fatalf("error invalid remote write config: %v", err)
+			}
+			http.HandleFunc(zabbixsvc.RemoteWritePath, h.Requests.Wrap("", remoteWrite.HandlePost))
+			log.Infof("serving remote write on '%s'", zabbixsvc.RemoteWritePath)
+		}
+
+		if cfg.Send.TestToken != "" {
+			testAPI := &zabbixsvc.TestAPI{Handler: h, Token: cfg.Send.TestToken}
+			http.HandleFunc(zabbixsvc.TestPath, testAPI.HandlePost)
+			log.Infof("serving synthetic alerts on '%s'", zabbixsvc.TestPath)
+		}
+
+		http.HandleFunc(zabbixsvc.StatePath, h.State.HandleState)
+		http.HandleFunc(zabbixsvc.StatePath+"/", h.State.HandleState)
+
+		redacted, err := cfg.Redacted()
+		if err != nil {
+			log.Fatalf("error could not render config: %v", err)
+		}
+		status := zabbixsvc.NewStatusPage(h, string(redacted), cfg.Zabbix.Addr, ver.Version)
+		http.HandleFunc(zabbixsvc.StatusPath, status.HandleGet)
+
+		srv := &http.Server{Addr: cfg.Send.ListenAddress}
+		go func() {
+			var err error
+			if cfg.Send.TLS.Enabled() {
+				err = srv.ListenAndServeTLS(cfg.Send.TLS.CertFile, cfg.Send.TLS.KeyFile)
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+		log.Info("Zabbix sender started, listening on ", cfg.Send.ListenAddress)
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		log.Infof("caught signal %s, shutting down", <-sig)
+
+		// requests in flight finish before the queue is closed, so their alerts are sent too
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Errorf("error shutting down server: %v", err)
+		}
+		if h.Async != nil {
+			queued, _ := h.Async.Queued()
+			log.Infof("sending %d queued alert sends before exiting", queued)
+			close(asyncStop)
+			<-asyncDone
+		}
+
+	case replay.FullCommand():
+		// keep stdout for replayed metrics
+		log.SetOutput(os.Stderr)
+
+		o.String("zabbix-addr", &cfg.Zabbix.Addr, *replayZabbixAddr)
+		o.String("key-prefix", &cfg.KeyPrefix, *replayKeyPrefix)
+		o.String("default-host", &cfg.Send.DefaultHost, *replayDefaultHost)
+
+		if *replayHostsFile != "" {
+			hosts, err := zabbixsvc.LoadHostsFromFile(*replayHostsFile)
+			if err != nil {
+				log.Fatalf("cant load the hosts file: %v", err)
+			}
+			cfg.Send.Routing = hosts
+		}
+
+		h := &zabbixsvc.JSONHandler{
+			KeyPrefix:      cfg.KeyPrefix,
+			Keys:           cfg.Keys,
+			DefaultHost:    cfg.Send.DefaultHost,
+			Hosts:          cfg.Send.Routing,
+			Encoding:       cfg.Send.ValueEncoding,
+			Encodings:      cfg.Send.ValueEncodings,
+			Samples:        cfg.Samples,
+			BisectRejected: cfg.Send.BisectRejected,
+		}
+
+		if !*replayDryRun {
+			if err := cfg.ValidateSend(); err != nil {
+				log.Fatalf("error invalid configuration: %v", err)
+			}
+
+			s, err := zabbixsnd.New(cfg.Zabbix.Addr)
+			if err != nil {
+				log.Fatalf("error could not create zabbix sender: %v", err)
+			}
+			h.Sender = s
+		}
+
+		f, err := os.Open(*replayFile)
+		if err != nil {
+			log.Fatalf("error could not open capture file: %v", err)
+		}
+		defer f.Close()
+
+		var sources zabbixsvc.ReplaySources
+		for _, webhookConfig := range cfg.Send.Webhooks {
+			webhook, err := zabbixsvc.NewWebhook(h, webhookConfig)
+			if err != nil {
+				log.Fatalf("error invalid webhook %s: %v", webhookConfig.Path, err)
+			}
+			sources.Webhooks = append(sources.Webhooks, webhook)
+		}
+		if cfg.Send.PathRouting.Enabled() {
+			if sources.PathRouting, err = zabbixsvc.NewPathRouting(h, cfg.Send.PathRouting); err != nil {
+				log.Fatalf("error invalid path routing config: %v", err)
+			}
+		}
+
+		if err := h.Replay(f, os.Stdout, *replayDryRun, sources); err != nil {
+			log.Fatalf("error replaying capture file: %v", err)
 		}
 
 	case prov.FullCommand():
-		cfg, err := provisioner.LoadHostConfigFromFile(*provConfig)
+		o.String("user", &cfg.Zabbix.User, *provUser)
+		o.String("password", &cfg.Zabbix.Password, *provPassword)
+		o.String("url", &cfg.Zabbix.URL, *provURL)
+		o.String("key-prefix", &cfg.KeyPrefix, *provKeyPrefix)
+		o.String("prometheus-url", &cfg.Prov.PrometheusURL, *prometheusURL)
+		o.String("tls-ca-file", &cfg.Zabbix.TLS.CAFile, *provTLSCAFile)
+		o.Bool("tls-insecure-skip-verify", &cfg.Zabbix.TLS.InsecureSkipVerify, *provTLSInsecure)
+		o.String("sample-annotation", &cfg.Samples.Annotation, *provSampleAnnotation)
+		o.String("sample-label", &cfg.Samples.Label, *provSampleLabel)
+
+		if *provConfig != "" {
+			hosts, err := provisioner.LoadHostConfigFromFile(*provConfig)
+			if err != nil {
+				log.Fatal(err)
+			}
+			cfg.Prov.Hosts = hosts
+			log.Infof("loaded hosts configuration from '%s'", *provConfig)
+		}
+
+		if err := cfg.ValidateProv(); err != nil {
+			log.Fatalf("error invalid configuration: %v", err)
+		}
+
+		transport, err := cfg.Zabbix.TLS.Transport()
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("error invalid zabbix tls configuration: %s", err)
 		}
-		log.Infof("loaded hosts configuration from '%s'", *provConfig)
 
-		prov, err := provisioner.New(*prometheusURL, *provKeyPrefix, *provURL, *provUser, *provPassword, cfg)
+		prov, err := provisioner.New(cfg.Prov.PrometheusURL, cfg.KeyPrefix, cfg.Keys, cfg.Samples, cfg.Zabbix.URL, cfg.Zabbix.User, cfg.Zabbix.Password, cfg.ProvHosts(), transport)
 		if err != nil {
 			log.Fatalf("error failed to create provisioner: %s", err)
 		}
@@ -114,6 +465,144 @@ func main() {
 		if err := prov.Run(); err != nil {
 			log.Fatalf("error provisioning zabbix items: %s", err)
 		}
+
+	case bridgeCmd.FullCommand():
+		o.String("user", &cfg.Zabbix.User, *bridgeUser)
+		o.String("password", &cfg.Zabbix.Password, *bridgePassword)
+		o.String("url", &cfg.Zabbix.URL, *bridgeURL)
+		o.String("key-prefix", &cfg.KeyPrefix, *bridgeKeyPrefix)
+		o.String("alertmanager-url", &cfg.Bridge.AlertmanagerURL, *bridgeAlertmanagerURL)
+		o.Duration("interval", &cfg.Bridge.Interval, *bridgeInterval)
+		o.Duration("ack-silence-duration", &cfg.Bridge.AckSilenceDuration, *bridgeAckSilenceDuration)
+		o.String("host-label", &cfg.Bridge.HostLabel, *bridgeHostLabel)
+		o.Bool("global-silences", &cfg.Bridge.GlobalSilences, *bridgeGlobalSilences)
+		o.Bool("maintenance-silences", &cfg.Bridge.MaintenanceSilences, *bridgeMaintenanceSilences)
+		o.Bool("silence-maintenances", &cfg.Bridge.SilenceMaintenances, *bridgeSilenceMaintenances)
+		o.String("timezone", &cfg.Bridge.Timezone, *bridgeTimezone)
+		if len(*bridgeHosts) != 0 {
+			cfg.Bridge.Hosts = *bridgeHosts
+		}
+
+		if err := cfg.ValidateBridge(); err != nil {
+			log.Fatalf("error invalid configuration: %v", err)
+		}
+
+		transport, err := cfg.Zabbix.TLS.Transport()
+		if err != nil {
+			log.Fatalf("error invalid zabbix tls configuration: %s", err)
+		}
+
+		location, err := cfg.Bridge.Location()
+		if err != nil {
+			log.Fatalf("error invalid time zone: %s", err)
+		}
+
+		b := bridge.New(bridge.Config{
+			ZabbixURL:           cfg.Zabbix.URL,
+			User:                cfg.Zabbix.User,
+			Password:            cfg.Zabbix.Password,
+			AlertmanagerURL:     cfg.Bridge.AlertmanagerURL,
+			Transport:           transport,
+			KeyPrefix:           cfg.KeyPrefix,
+			Hosts:               cfg.BridgeHosts(),
+			AckSilenceDuration:  cfg.Bridge.AckSilenceDuration,
+			HostLabel:           cfg.Bridge.HostLabel,
+			GlobalSilences:      cfg.Bridge.GlobalSilences,
+			MaintenanceSilences: cfg.Bridge.MaintenanceSilences,
+			SilenceMaintenances: cfg.Bridge.SilenceMaintenances,
+			Location:            location,
+		})
+
+		http.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if err := http.ListenAndServe(*bridgeMetricsAddr, nil); err != nil {
+				log.Fatal(err)
+			}
+		}()
+
+		log.Infof("Zabbix bridge started, syncing hosts %v every %s", cfg.BridgeHosts(), cfg.Bridge.Interval)
+		b.Run(cfg.Bridge.Interval, make(chan struct{}))
+
+	case pullCmd.FullCommand():
+		o.String("user", &cfg.Zabbix.User, *pullUser)
+		o.String("password", &cfg.Zabbix.Password, *pullPassword)
+		o.String("url", &cfg.Zabbix.URL, *pullURL)
+		o.String("key-prefix", &cfg.KeyPrefix, *pullKeyPrefix)
+		o.String("alertmanager-url", &cfg.Pull.AlertmanagerURL, *pullAlertmanagerURL)
+		o.Duration("interval", &cfg.Pull.Interval, *pullInterval)
+		o.Duration("resolve-timeout", &cfg.Pull.ResolveTimeout, *pullResolveTimeout)
+		if len(*pullHostGroups) != 0 {
+			cfg.Pull.HostGroups = *pullHostGroups
+		}
+
+		if err := cfg.ValidatePull(); err != nil {
+			log.Fatalf("error invalid configuration: %v", err)
+		}
+
+		transport, err := cfg.Zabbix.TLS.Transport()
+		if err != nil {
+			log.Fatalf("error invalid zabbix tls configuration: %s", err)
+		}
+
+		b := bridge.New(bridge.Config{
+			ZabbixURL:       cfg.Zabbix.URL,
+			User:            cfg.Zabbix.User,
+			Password:        cfg.Zabbix.Password,
+			AlertmanagerURL: cfg.Pull.AlertmanagerURL,
+			Transport:       transport,
+			KeyPrefix:       cfg.KeyPrefix,
+			PullProblems:    true,
+			ResolveTimeout:  cfg.Pull.ResolveTimeout,
+			HostGroups:      cfg.Pull.HostGroups,
+		})
+
+		http.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if err := http.ListenAndServe(*pullMetricsAddr, nil); err != nil {
+				log.Fatal(err)
+			}
+		}()
+
+		log.Infof("Zabbix pull started, forwarding problems to %s every %s", cfg.Pull.AlertmanagerURL, cfg.Pull.Interval)
+		b.Run(cfg.Pull.Interval, make(chan struct{}))
+
+	case exporterCmd.FullCommand():
+		o.String("user", &cfg.Zabbix.User, *exporterUser)
+		o.String("password", &cfg.Zabbix.Password, *exporterPassword)
+		o.String("url", &cfg.Zabbix.URL, *exporterURL)
+		o.String("key-prefix", &cfg.KeyPrefix, *exporterKeyPrefix)
+		o.String("addr", &cfg.Exporter.ListenAddress, *exporterAddr)
+		o.Duration("refresh-interval", &cfg.Exporter.RefreshInterval, *exporterRefreshInterval)
+		if len(*exporterHosts) != 0 {
+			cfg.Exporter.Hosts = *exporterHosts
+		}
+
+		if err := cfg.ValidateExporter(); err != nil {
+			log.Fatalf("error invalid configuration: %v", err)
+		}
+
+		transport, err := cfg.Zabbix.TLS.Transport()
+		if err != nil {
+			log.Fatalf("error invalid zabbix tls configuration: %s", err)
+		}
+
+		e := exporter.New(exporter.Config{
+			ZabbixURL: cfg.Zabbix.URL,
+			User:      cfg.Zabbix.User,
+			Password:  cfg.Zabbix.Password,
+			Transport: transport,
+			KeyPrefix: cfg.KeyPrefix,
+			Hosts:     cfg.Exporter.Hosts,
+		})
+		prometheus.MustRegister(e)
+
+		go e.Run(cfg.Exporter.RefreshInterval, make(chan struct{}))
+
+		http.Handle("/metrics", promhttp.Handler())
+		log.Infof("Zabbix exporter listening on %s, refreshing every %s", cfg.Exporter.ListenAddress, cfg.Exporter.RefreshInterval)
+		if err := http.ListenAndServe(cfg.Exporter.ListenAddress, nil); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
@@ -0,0 +1,725 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/itemkey"
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
+	"github.com/devopyio/zabbix-alertmanager/tracing"
+	"github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/provisioner"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config is the zal configuration file.
+type Config struct {
+	// KeyPrefix is shared by zal send and zal prov, so that sent keys match provisioned items.
+	KeyPrefix string `yaml:"keyPrefix"`
+	// Keys turns alert names into item keys, shared by zal send and zal prov like KeyPrefix.
+	Keys itemkey.Config `yaml:"keys"`
+	// Samples forwards sample values of alerts to float items, zal prov creates the items of rules declaring them.
+	Samples  itemvalue.SampleConfig `yaml:"samples"`
+	Zabbix   ZabbixConfig           `yaml:"zabbix"`
+	Send     SendConfig             `yaml:"send"`
+	Prov     ProvConfig             `yaml:"prov"`
+	Bridge   BridgeConfig           `yaml:"bridge"`
+	Pull     PullConfig             `yaml:"pull"`
+	Exporter ExporterConfig         `yaml:"exporter"`
+}
+
+// ZabbixConfig configures Zabbix trapper and json rpc api targets.
+type ZabbixConfig struct {
+	// Addr is Zabbix trapper address used by zal send.
+	Addr string `yaml:"addr"`
+	// URL is Zabbix json rpc url used by zal prov.
+	URL          string    `yaml:"url"`
+	User         string    `yaml:"user"`
+	Password     string    `yaml:"password"`
+	PasswordFile string    `yaml:"passwordFile"`
+	TLS          TLSConfig `yaml:"tls"`
+}
+
+// SendConfig configures zal send.
+type SendConfig struct {
+	ListenAddress string `yaml:"listenAddress"`
+	DefaultHost   string `yaml:"defaultHost"`
+	// Routing maps Alertmanager receivers to Zabbix hosts.
+	Routing map[string]string `yaml:"routing"`
+	// ValueEncoding encodes alert status in item values, ValueEncodings overrides it by Zabbix host.
+	// zal prov creates items and triggers of the same encoding.
+	ValueEncoding  string            `yaml:"valueEncoding"`
+	ValueEncodings map[string]string `yaml:"valueEncodings"`
+	// PathRouting allows hosts set in the path of /alerts/{host} and /alerts/{host}/{keyPrefix} requests.
+	PathRouting zabbixsvc.PathRoutingConfig `yaml:"pathRouting"`
+	Retry       RetryConfig                 `yaml:"retry"`
+	TLS         TLSConfig                   `yaml:"tls"`
+	// Webhooks are generic JSON inputs mapped to alerts.
+	Webhooks []zabbixsvc.WebhookConfig `yaml:"webhooks"`
+	// RemoteWrite maps Prometheus remote_write series to Zabbix trapper items.
+	RemoteWrite zabbixsvc.RemoteWriteConfig `yaml:"remoteWrite"`
+	// Tracing exports OpenTelemetry spans of received requests and Zabbix sends.
+	Tracing tracing.Config `yaml:"tracing"`
+	// BisectRejected finds metrics Zabbix rejected by splitting the packet, requests with rejected
+	// metrics succeed so they are not retried forever.
+	BisectRejected bool `yaml:"bisectRejected"`
+	// Async queues alerts and sends them to Zabbix in the background.
+	Async zabbixsvc.AsyncConfig `yaml:"async"`
+	// DedupeWindow is the time a notification of an Alertmanager group is remembered, so copies sent
+	// by other cluster members or retries are not sent to Zabbix again. Zero disables deduplication.
+	DedupeWindow time.Duration `yaml:"dedupeWindow"`
+	// TestToken enables the synthetic alert endpoint, requests must have it as bearer token.
+	TestToken     string `yaml:"testToken"`
+	TestTokenFile string `yaml:"testTokenFile"`
+	// DryRun logs and records metrics instead of sending them to Zabbix.
+	DryRun bool `yaml:"dryRun"`
+	// Capture writes received requests to a file, which zal replay can send again.
+	Capture CaptureConfig `yaml:"capture"`
+	// AlertsAPI configures alerts pushed by Prometheus to /api/v2/alerts.
+	AlertsAPI AlertsAPIConfig `yaml:"alertsApi"`
+	// StatusRequests is the number of recent requests shown on the status page.
+	StatusRequests int `yaml:"statusRequests"`
+}
+
+// CaptureConfig configures the capture file of received requests, empty path disables capturing.
+type CaptureConfig struct {
+	Path string `yaml:"path"`
+	// MaxSize is the size in bytes at which the file is rotated, 0 disables rotation.
+	MaxSize  int64 `yaml:"maxSize"`
+	MaxFiles int   `yaml:"maxFiles"`
+}
+
+// AlertsAPIConfig configures alerts pushed by Prometheus.
+type AlertsAPIConfig struct {
+	// Receiver is used to route pushed alerts.
+	Receiver string `yaml:"receiver"`
+	// ResolveTimeout is the time after which alerts without endsAt are resolved.
+	ResolveTimeout time.Duration `yaml:"resolveTimeout"`
+}
+
+// RetryConfig configures retries of failed Zabbix sends.
+type RetryConfig struct {
+	Retries int           `yaml:"retries"`
+	Backoff time.Duration `yaml:"backoff"`
+}
+
+// TLSConfig configures TLS of the zal send server or the Zabbix api client.
+type TLSConfig struct {
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	CAFile             string `yaml:"caFile"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// ProvConfig configures zal prov.
+type ProvConfig struct {
+	PrometheusURL string                   `yaml:"prometheusUrl"`
+	Hosts         []provisioner.HostConfig `yaml:"hosts"`
+}
+
+// BridgeConfig configures zal bridge.
+type BridgeConfig struct {
+	AlertmanagerURL string        `yaml:"alertmanagerUrl"`
+	Interval        time.Duration `yaml:"interval"`
+	// Hosts are the zal managed Zabbix hosts, defaults to prov hosts and send routing hosts.
+	Hosts []string `yaml:"hosts"`
+	// AckSilenceDuration is the duration of silences created for acknowledged problems, zero disables them.
+	AckSilenceDuration time.Duration `yaml:"ackSilenceDuration"`
+	// HostLabel is the alert label holding the Zabbix host name, silences match it to silence alerts of one host.
+	HostLabel string `yaml:"hostLabel"`
+	// GlobalSilences allows silences without host label, which silence alertnames on all hosts.
+	GlobalSilences bool `yaml:"globalSilences"`
+	// MaintenanceSilences silences alerts of hosts in Zabbix maintenance.
+	MaintenanceSilences bool `yaml:"maintenanceSilences"`
+	// SilenceMaintenances creates Zabbix maintenances for Alertmanager silences of zal managed triggers.
+	SilenceMaintenances bool `yaml:"silenceMaintenances"`
+	// Timezone of the Zabbix server, used to evaluate maintenance periods, defaults to local time zone.
+	Timezone string `yaml:"timezone"`
+}
+
+// PullConfig configures zal pull.
+type PullConfig struct {
+	AlertmanagerURL string        `yaml:"alertmanagerUrl"`
+	Interval        time.Duration `yaml:"interval"`
+	// ResolveTimeout is the end time of pulled alerts, they are resolved unless refreshed by a sync.
+	ResolveTimeout time.Duration `yaml:"resolveTimeout"`
+	// HostGroups limits pulled problems to hosts of the groups, empty pulls problems of all hosts.
+	HostGroups []string `yaml:"hostGroups"`
+}
+
+// ExporterConfig configures zal exporter.
+type ExporterConfig struct {
+	ListenAddress string `yaml:"listenAddress"`
+	// RefreshInterval is the time between Zabbix api queries, scrapes get cached metrics.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	// Hosts limits exported state to the Zabbix hosts, empty exports all monitored hosts.
+	Hosts []string `yaml:"hosts"`
+}
+
+// Location returns the Zabbix server time zone.
+func (b *BridgeConfig) Location() (*time.Location, error) {
+	if b.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(b.Timezone)
+}
+
+// Default returns configuration with the same defaults as zal command line flags.
+func Default() *Config {
+	return &Config{
+		KeyPrefix: "prometheus",
+		Keys: itemkey.Config{
+			Replacement: itemkey.DefaultReplacement,
+			MaxLength:   255,
+		},
+		Samples: itemvalue.SampleConfig{
+			KeySuffix: itemvalue.DefaultSampleSuffix,
+		},
+		Zabbix: ZabbixConfig{
+			URL: "http://127.0.0.1/zabbix/api_jsonrpc.php",
+		},
+		Send: SendConfig{
+			ListenAddress: "0.0.0.0:9095",
+			DefaultHost:   "prometheus",
+			Routing:       map[string]string{},
+			Retry: RetryConfig{
+				Backoff: time.Second,
+			},
+			RemoteWrite: zabbixsvc.RemoteWriteConfig{
+				BatchSize: 1000,
+			},
+			Tracing: tracing.Config{
+				SampleRatio: 1,
+			},
+			Async: zabbixsvc.AsyncConfig{
+				QueueSize: 1000,
+				Workers:   4,
+			},
+			Capture: CaptureConfig{
+				MaxSize:  100 * 1024 * 1024,
+				MaxFiles: 5,
+			},
+			AlertsAPI: AlertsAPIConfig{
+				Receiver:       "prometheus",
+				ResolveTimeout: 5 * time.Minute,
+			},
+			StatusRequests: 100,
+		},
+		Bridge: BridgeConfig{
+			AlertmanagerURL:     "http://127.0.0.1:9093",
+			Interval:            time.Minute,
+			AckSilenceDuration:  2 * time.Hour,
+			MaintenanceSilences: true,
+		},
+		Pull: PullConfig{
+			AlertmanagerURL: "http://127.0.0.1:9093",
+			Interval:        time.Minute,
+			ResolveTimeout:  5 * time.Minute,
+		},
+		Exporter: ExporterConfig{
+			ListenAddress:   "0.0.0.0:9098",
+			RefreshInterval: time.Minute,
+		},
+	}
+}
+
+// reservedPaths are served by zal send and can't be used by webhooks.
+var reservedPaths = []string{"/", "/metrics", "/alerts", "/grafana", zabbixsvc.AlertsAPIPath, zabbixsvc.StatePath, zabbixsvc.RemoteWritePath, zabbixsvc.TestPath, zabbixsvc.StatusPath}
+
+var envRegexp = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// expandEnv replaces ${VAR} with the value of environment variable VAR.
+// Comment lines are left as is.
+func expandEnv(b []byte) ([]byte, error) {
+	var missing []string
+
+	lines := bytes.Split(b, []byte("\n"))
+	for i, line := range lines {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("#")) {
+			continue
+		}
+
+		lines[i] = envRegexp.ReplaceAllFunc(line, func(m []byte) []byte {
+			name := string(envRegexp.FindSubmatch(m)[1])
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+			return []byte(v)
+		})
+	}
+
+	if len(missing) != 0 {
+		return nil, errors.Errorf("environment variables are not set: %s", strings.Join(missing, ", "))
+	}
+
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// Load parses configuration, expands environment variables, reads secret files and validates it.
+// Fields missing in the configuration keep their default values.
+func Load(b []byte) (*Config, error) {
+	b, err := expandEnv(b)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, errors.Wrap(err, "can't parse the config")
+	}
+
+	if cfg.Zabbix.PasswordFile != "" {
+		if cfg.Zabbix.Password != "" {
+			return nil, errors.New("zabbix: password and passwordFile are mutually exclusive")
+		}
+
+		password, err := ioutil.ReadFile(cfg.Zabbix.PasswordFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "zabbix: can't read passwordFile")
+		}
+		cfg.Zabbix.Password = strings.TrimSpace(string(password))
+	}
+
+	if cfg.Send.TestTokenFile != "" {
+		if cfg.Send.TestToken != "" {
+			return nil, errors.New("send: testToken and testTokenFile are mutually exclusive")
+		}
+
+		token, err := ioutil.ReadFile(cfg.Send.TestTokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "send: can't read testTokenFile")
+		}
+		cfg.Send.TestToken = strings.TrimSpace(string(token))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// LoadFile loads configuration from file.
+func LoadFile(filename string) (*Config, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open the config file: %s", filename)
+	}
+
+	cfg, err := Load(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config file: %s", filename)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks fields shared by all commands.
+func (c *Config) Validate() error {
+	if c.KeyPrefix == "" {
+		return errors.New("keyPrefix: must not be empty")
+	}
+
+	if err := c.Keys.Validate(); err != nil {
+		return errors.Wrap(err, "keys")
+	}
+
+	if err := c.Keys.ValidatePrefix(c.KeyPrefix); err != nil {
+		return errors.Wrap(err, "keys")
+	}
+
+	if err := c.Samples.Validate(); err != nil {
+		return errors.Wrap(err, "samples")
+	}
+
+	if err := c.Zabbix.TLS.validate(); err != nil {
+		return errors.Wrap(err, "zabbix.tls")
+	}
+
+	if _, _, err := net.SplitHostPort(c.Send.ListenAddress); err != nil {
+		return errors.Wrapf(err, "send.listenAddress: invalid address %q", c.Send.ListenAddress)
+	}
+
+	if c.Send.DefaultHost == "" {
+		return errors.New("send.defaultHost: must not be empty")
+	}
+
+	for receiver, host := range c.Send.Routing {
+		if host == "" {
+			return errors.Errorf("send.routing: empty host for receiver %q", receiver)
+		}
+	}
+
+	if c.Send.Retry.Retries < 0 {
+		return errors.Errorf("send.retry.retries: must not be negative, got %d", c.Send.Retry.Retries)
+	}
+
+	if c.Send.Retry.Backoff < 0 {
+		return errors.Errorf("send.retry.backoff: must not be negative, got %s", c.Send.Retry.Backoff)
+	}
+
+	if err := c.Send.TLS.validate(); err != nil {
+		return errors.Wrap(err, "send.tls")
+	}
+
+	if err := itemvalue.Validate(c.Send.ValueEncoding); err != nil {
+		return errors.Wrap(err, "send.valueEncoding")
+	}
+	for host, encoding := range c.Send.ValueEncodings {
+		if err := itemvalue.Validate(encoding); err != nil {
+			return errors.Wrapf(err, "send.valueEncodings[%s]", host)
+		}
+	}
+	for i, host := range c.Prov.Hosts {
+		if err := itemvalue.Validate(host.ValueEncoding); err != nil {
+			return errors.Wrapf(err, "prov.hosts[%d].valueEncoding", i)
+		}
+		if host.ValueEncoding != "" && host.ValueEncoding != c.ValueEncoding(host.Name) {
+			return errors.Errorf("prov.hosts[%d].valueEncoding: %s differs from %s sent by zal send", i, host.ValueEncoding, c.ValueEncoding(host.Name))
+		}
+	}
+
+	if err := c.Send.PathRouting.Validate(); err != nil {
+		return errors.Wrap(err, "send.pathRouting")
+	}
+
+	paths := map[string]struct{}{}
+	for _, p := range reservedPaths {
+		paths[p] = struct{}{}
+	}
+	for i, webhook := range c.Send.Webhooks {
+		if err := webhook.Validate(); err != nil {
+			return errors.Wrapf(err, "send.webhooks[%d]", i)
+		}
+		if _, ok := paths[webhook.Path]; ok {
+			return errors.Errorf("send.webhooks[%d].path: path %q is already used", i, webhook.Path)
+		}
+		if c.Send.PathRouting.Enabled() && strings.HasPrefix(webhook.Path, zabbixsvc.PathRoutingPath) {
+			return errors.Errorf("send.webhooks[%d].path: paths under %q are used by path routing", i, zabbixsvc.PathRoutingPath)
+		}
+		paths[webhook.Path] = struct{}{}
+	}
+
+	if err := c.Send.RemoteWrite.Validate(); err != nil {
+		return errors.Wrap(err, "send.remoteWrite")
+	}
+
+	if err := c.Send.Tracing.Validate(); err != nil {
+		return errors.Wrap(err, "send.tracing")
+	}
+
+	if err := c.Send.Async.Validate(); err != nil {
+		return errors.Wrap(err, "send.async")
+	}
+
+	if c.Send.DedupeWindow < 0 {
+		return errors.Errorf("send.dedupeWindow: must not be negative, got %s", c.Send.DedupeWindow)
+	}
+
+	if c.Send.Capture.MaxSize < 0 {
+		return errors.Errorf("send.capture.maxSize: must not be negative, got %d", c.Send.Capture.MaxSize)
+	}
+
+	if c.Send.Capture.MaxFiles < 0 {
+		return errors.Errorf("send.capture.maxFiles: must not be negative, got %d", c.Send.Capture.MaxFiles)
+	}
+
+	if c.Send.AlertsAPI.Receiver == "" {
+		return errors.New("send.alertsApi.receiver: must not be empty")
+	}
+
+	if c.Send.AlertsAPI.ResolveTimeout <= 0 {
+		return errors.Errorf("send.alertsApi.resolveTimeout: must be positive, got %s", c.Send.AlertsAPI.ResolveTimeout)
+	}
+
+	if c.Send.StatusRequests < 0 {
+		return errors.Errorf("send.statusRequests: must not be negative, got %d", c.Send.StatusRequests)
+	}
+
+	if _, err := c.Bridge.Location(); err != nil {
+		return errors.Wrapf(err, "bridge.timezone: invalid time zone %q", c.Bridge.Timezone)
+	}
+
+	names := make(map[string]struct{}, len(c.Prov.Hosts))
+	for i, host := range c.Prov.Hosts {
+		if host.Name == "" {
+			return errors.Errorf("prov.hosts[%d].name: must not be empty", i)
+		}
+		if host.HostAlertsDir == "" {
+			return errors.Errorf("prov.hosts[%d].alertsDir: must not be empty", i)
+		}
+		if _, ok := names[host.Name]; ok {
+			return errors.Errorf("prov.hosts[%d].name: duplicate host %q", i, host.Name)
+		}
+		names[host.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// ValidateSend checks fields required by zal send.
+func (c *Config) ValidateSend() error {
+	if c.Zabbix.Addr == "" {
+		return errors.New("zabbix.addr: Zabbix address is required")
+	}
+
+	return c.Validate()
+}
+
+// ValidateProv checks fields required by zal prov.
+func (c *Config) ValidateProv() error {
+	if c.Zabbix.URL == "" {
+		return errors.New("zabbix.url: Zabbix json rpc url is required")
+	}
+
+	if c.Zabbix.User == "" {
+		return errors.New("zabbix.user: Zabbix json rpc user is required")
+	}
+
+	if c.Zabbix.Password == "" {
+		return errors.New("zabbix.password: Zabbix json rpc password is required")
+	}
+
+	if len(c.Prov.Hosts) == 0 {
+		return errors.New("prov.hosts: no hosts are defined")
+	}
+
+	return c.Validate()
+}
+
+// ValidateBridge checks fields required by zal bridge.
+func (c *Config) ValidateBridge() error {
+	if c.Zabbix.URL == "" {
+		return errors.New("zabbix.url: Zabbix json rpc url is required")
+	}
+
+	if c.Zabbix.User == "" {
+		return errors.New("zabbix.user: Zabbix json rpc user is required")
+	}
+
+	if c.Zabbix.Password == "" {
+		return errors.New("zabbix.password: Zabbix json rpc password is required")
+	}
+
+	if c.Bridge.AlertmanagerURL == "" {
+		return errors.New("bridge.alertmanagerUrl: Alertmanager url is required")
+	}
+
+	if c.Bridge.Interval <= 0 {
+		return errors.Errorf("bridge.interval: must be positive, got %s", c.Bridge.Interval)
+	}
+
+	if c.Bridge.AckSilenceDuration < 0 {
+		return errors.Errorf("bridge.ackSilenceDuration: must not be negative, got %s", c.Bridge.AckSilenceDuration)
+	}
+
+	if (c.Bridge.AckSilenceDuration > 0 || c.Bridge.MaintenanceSilences) && c.Bridge.HostLabel == "" && !c.Bridge.GlobalSilences {
+		return errors.New("bridge.hostLabel: required by ack and maintenance silences, or enable bridge.globalSilences to silence alertnames on all hosts")
+	}
+
+	if len(c.BridgeHosts()) == 0 {
+		return errors.New("bridge.hosts: no hosts are defined")
+	}
+
+	return c.Validate()
+}
+
+// ValidatePull checks fields required by zal pull.
+func (c *Config) ValidatePull() error {
+	if c.Zabbix.URL == "" {
+		return errors.New("zabbix.url: Zabbix json rpc url is required")
+	}
+
+	if c.Zabbix.User == "" {
+		return errors.New("zabbix.user: Zabbix json rpc user is required")
+	}
+
+	if c.Zabbix.Password == "" {
+		return errors.New("zabbix.password: Zabbix json rpc password is required")
+	}
+
+	if c.Pull.AlertmanagerURL == "" {
+		return errors.New("pull.alertmanagerUrl: Alertmanager url is required")
+	}
+
+	if c.Pull.Interval <= 0 {
+		return errors.Errorf("pull.interval: must be positive, got %s", c.Pull.Interval)
+	}
+
+	// alerts would be resolved between syncs
+	if c.Pull.ResolveTimeout <= c.Pull.Interval {
+		return errors.Errorf("pull.resolveTimeout: must be longer than interval %s, got %s", c.Pull.Interval, c.Pull.ResolveTimeout)
+	}
+
+	return c.Validate()
+}
+
+// ValidateExporter checks fields required by zal exporter.
+func (c *Config) ValidateExporter() error {
+	if c.Zabbix.URL == "" {
+		return errors.New("zabbix.url: Zabbix json rpc url is required")
+	}
+
+	if c.Zabbix.User == "" {
+		return errors.New("zabbix.user: Zabbix json rpc user is required")
+	}
+
+	if c.Zabbix.Password == "" {
+		return errors.New("zabbix.password: Zabbix json rpc password is required")
+	}
+
+	if _, _, err := net.SplitHostPort(c.Exporter.ListenAddress); err != nil {
+		return errors.Wrapf(err, "exporter.listenAddress: invalid address %q", c.Exporter.ListenAddress)
+	}
+
+	if c.Exporter.RefreshInterval <= 0 {
+		return errors.Errorf("exporter.refreshInterval: must be positive, got %s", c.Exporter.RefreshInterval)
+	}
+
+	return c.Validate()
+}
+
+// ValueEncoding returns the value encoding zal send uses for items of the host.
+func (c *Config) ValueEncoding(host string) string {
+	if encoding, ok := c.Send.ValueEncodings[host]; ok {
+		return encoding
+	}
+	if c.Send.ValueEncoding != "" {
+		return c.Send.ValueEncoding
+	}
+	return itemvalue.Numeric
+}
+
+// redacted replaces secrets set in the config.
+const redacted = "<redacted>"
+
+// Redacted returns the config as YAML with the Zabbix password and the test token redacted,
+// secrets read from files are left out.
+func (c *Config) Redacted() ([]byte, error) {
+	r := *c
+	switch {
+	case r.Zabbix.PasswordFile != "":
+		r.Zabbix.Password = ""
+	case r.Zabbix.Password != "":
+		r.Zabbix.Password = redacted
+	}
+	switch {
+	case r.Send.TestTokenFile != "":
+		r.Send.TestToken = ""
+	case r.Send.TestToken != "":
+		r.Send.TestToken = redacted
+	}
+	return yaml.Marshal(&r)
+}
+
+// ProvHosts returns prov hosts with the value encoding of zal send.
+func (c *Config) ProvHosts() []provisioner.HostConfig {
+	hosts := make([]provisioner.HostConfig, len(c.Prov.Hosts))
+	for i, host := range c.Prov.Hosts {
+		host.ValueEncoding = c.ValueEncoding(host.Name)
+		hosts[i] = host
+	}
+	return hosts
+}
+
+// BridgeHosts returns zal managed hosts, which are bridge hosts if set,
+// otherwise prov hosts, send routing hosts, path routing hosts and the default host.
+func (c *Config) BridgeHosts() []string {
+	if len(c.Bridge.Hosts) != 0 {
+		return c.Bridge.Hosts
+	}
+
+	seen := map[string]bool{}
+	var hosts []string
+	add := func(host string) {
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+
+	for _, host := range c.Prov.Hosts {
+		add(host.Name)
+	}
+
+	routing := make([]string, 0, len(c.Send.Routing))
+	for _, host := range c.Send.Routing {
+		routing = append(routing, host)
+	}
+	sort.Strings(routing)
+	for _, host := range routing {
+		add(host)
+	}
+	for _, host := range c.Send.PathRouting.Hosts {
+		add(host)
+	}
+	add(c.Send.DefaultHost)
+
+	return hosts
+}
+
+func (t *TLSConfig) validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("certFile and keyFile must be set together")
+	}
+
+	return nil
+}
+
+// Enabled reports whether server certificate is configured.
+func (t *TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// ClientConfig creates tls config for clients.
+func (t *TLSConfig) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		ca, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read the ca file: %s", t.CAFile)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no certificates found in the ca file: %s", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't load the client certificate")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// Transport creates http transport which uses the client tls config.
+func (t *TLSConfig) Transport() (http.RoundTripper, error) {
+	tlsConfig, err := t.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
@@ -0,0 +1,183 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/config"
+)
+
+func TestLoadExample(t *testing.T) {
+	t.Setenv("ZABBIX_USER", "zal")
+	t.Setenv("ZAL_TEST_TOKEN", "token")
+
+	b, err := ioutil.ReadFile("../zal.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b = []byte(strings.Replace(string(b), "/etc/zal/zabbix-password", passwordFile, 1))
+
+	cfg, err := config.Load(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Zabbix.User != "zal" || cfg.Zabbix.Password != "secret" {
+		t.Fatalf("Unexpected credentials: %s, %s", cfg.Zabbix.User, cfg.Zabbix.Password)
+	}
+	if cfg.Send.Routing["received2"] != "default2" || cfg.Send.Retry.Retries != 3 || cfg.Send.Retry.Backoff != time.Second {
+		t.Fatalf("Unexpected send config: %+v", cfg.Send)
+	}
+	if cfg.Send.TestToken != "token" {
+		t.Fatalf("Unexpected test token: %q", cfg.Send.TestToken)
+	}
+	if !cfg.Samples.Enabled() || cfg.Samples.Suffix() != "value" {
+		t.Fatalf("Unexpected samples config: %+v", cfg.Samples)
+	}
+	if len(cfg.Prov.Hosts) != 1 || cfg.Prov.Hosts[0].ItemDefaultApplication != "prometheus" {
+		t.Fatalf("Unexpected prov hosts: %+v", cfg.Prov.Hosts)
+	}
+	if err := cfg.ValidateSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateProv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateBridge(); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := cfg.BridgeHosts(); strings.Join(hosts, ",") != "infra,default1,default2,web1" {
+		t.Fatalf("Unexpected bridge hosts: %v", hosts)
+	}
+	if err := cfg.ValidatePull(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateExporter(); err != nil {
+		t.Fatal(err)
+	}
+
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(redacted), "secret") || strings.Contains(string(redacted), "token\n") {
+		t.Fatalf("Expected secrets to be redacted, got:\n%s", redacted)
+	}
+	if _, err := config.Load(redacted); err != nil {
+		t.Fatalf("Expected redacted config to load: %v", err)
+	}
+	if cfg.Zabbix.Password != "secret" || cfg.Send.TestToken != "token" {
+		t.Fatal("Expected Redacted to keep the config secrets")
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := config.Load([]byte("zabbix:\n  addr: zabbix:10051\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.KeyPrefix != "prometheus" || cfg.Send.ListenAddress != "0.0.0.0:9095" || cfg.Send.DefaultHost != "prometheus" {
+		t.Fatalf("Expected defaults, got %+v", cfg)
+	}
+	if err := cfg.ValidateSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ValidateProv(); err == nil {
+		t.Fatal("Expected prov config to be invalid")
+	}
+	if cfg.Pull.Interval != time.Minute || cfg.Pull.ResolveTimeout != 5*time.Minute {
+		t.Fatalf("Expected pull defaults, got %+v", cfg.Pull)
+	}
+	if cfg.Exporter.ListenAddress != "0.0.0.0:9098" || cfg.Exporter.RefreshInterval != time.Minute {
+		t.Fatalf("Expected exporter defaults, got %+v", cfg.Exporter)
+	}
+	if cfg.Send.AlertsAPI.Receiver != "prometheus" || cfg.Send.Capture.MaxFiles != 5 || cfg.Send.StatusRequests != 100 {
+		t.Fatalf("Expected send defaults, got %+v", cfg.Send)
+	}
+}
+
+func TestValidateBridgeSilences(t *testing.T) {
+	cfg, err := config.Load([]byte("zabbix:\n  user: zal\n  password: secret\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.ValidateBridge(); err == nil || !strings.Contains(err.Error(), "bridge.hostLabel") {
+		t.Fatalf("Expected host label error, got %v", err)
+	}
+
+	cfg.Bridge.GlobalSilences = true
+	if err := cfg.ValidateBridge(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Bridge.GlobalSilences = false
+	cfg.Bridge.HostLabel = "zabbix_host"
+	if err := cfg.ValidateBridge(); err != nil {
+		t.Fatal(err)
+	}
+
+	// maintenance silences need the host label too
+	cfg.Bridge.HostLabel = ""
+	cfg.Bridge.AckSilenceDuration = 0
+	if err := cfg.ValidateBridge(); err == nil || !strings.Contains(err.Error(), "bridge.hostLabel") {
+		t.Fatalf("Expected host label error, got %v", err)
+	}
+
+	cfg.Bridge.MaintenanceSilences = false
+	if err := cfg.ValidateBridge(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		config string
+		err    string
+	}{
+		{config: "zabbix:\n  user: ${ZAL_TEST_MISSING}\n", err: "ZAL_TEST_MISSING"},
+		{config: "send:\n  listenAdress: :9095\n", err: "listenAdress"},
+		{config: "send:\n  listenAddress: localhost\n", err: "send.listenAddress"},
+		{config: "keyPrefix: \"\"\n", err: "keyPrefix"},
+		{config: "keys:\n  aliases:\n    DiskFull: Disk Full\n", err: "keys"},
+		{config: "keys:\n  maxLength: 5\n", err: "keys"},
+		{config: "keyPrefix: zabbix.alertmanager.prometheus\nkeys:\n  maxLength: 36\n", err: "keys: maxLength"},
+		{config: "samples:\n  keySuffix: Value\n", err: "samples: keySuffix"},
+		{config: "send:\n  retry:\n    retries: -1\n", err: "send.retry.retries"},
+		{config: "send:\n  tls:\n    certFile: cert.pem\n", err: "send.tls"},
+		{config: "zabbix:\n  password: a\n  passwordFile: b\n", err: "mutually exclusive"},
+		{config: "send:\n  testToken: a\n  testTokenFile: b\n", err: "send: testToken and testTokenFile"},
+		{config: "send:\n  webhooks:\n    - {path: /alerts, alertname: a, status: b}\n", err: "already used"},
+		{config: "send:\n  webhooks:\n    - {path: /a, status: b}\n", err: "send.webhooks[0]"},
+		{config: "prov:\n  hosts:\n    - name: a\n", err: "prov.hosts[0].alertsDir"},
+		{config: "send:\n  remoteWrite:\n    series:\n      - {matchers: ['job=node'], key: a}\n", err: "send.remoteWrite"},
+		{config: "send:\n  tracing:\n    exporter: jaeger\n", err: "send.tracing"},
+		{config: "send:\n  valueEncodings:\n    web1: boolean\n", err: "send.valueEncodings[web1]"},
+		{config: "send:\n  valueEncoding: string\nprov:\n  hosts:\n    - {name: web1, alertsDir: /rules, valueEncoding: json}\n", err: "prov.hosts[0].valueEncoding"},
+		{config: "send:\n  async:\n    enabled: true\n    workers: 0\n", err: "send.async"},
+		{config: "send:\n  pathRouting:\n    pattern: \"(\"\n", err: "send.pathRouting"},
+		{config: "send:\n  dedupeWindow: -1s\n", err: "send.dedupeWindow"},
+		{config: "send:\n  capture:\n    maxSize: -1\n", err: "send.capture.maxSize"},
+		{config: "send:\n  capture:\n    maxFiles: -1\n", err: "send.capture.maxFiles"},
+		{config: "send:\n  alertsApi:\n    receiver: \"\"\n", err: "send.alertsApi.receiver"},
+		{config: "send:\n  alertsApi:\n    resolveTimeout: 0s\n", err: "send.alertsApi.resolveTimeout"},
+		{config: "send:\n  statusRequests: -1\n", err: "send.statusRequests"},
+		{config: "send:\n  pathRouting:\n    hosts: [web1]\n  webhooks:\n    - path: /alerts/backup\n      alertname: Backup\n      status: firing\n", err: "send.webhooks[0].path"},
+		{config: "bridge:\n  timezone: Mars/Olympus\n", err: "bridge.timezone"},
+		{config: "prov:\n  hosts:\n    - {name: a, alertsDir: a}\n    - {name: a, alertsDir: b}\n", err: "duplicate host"},
+	} {
+		_, err := config.Load([]byte(tc.config))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error containing %q, got %v", tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package itemkey
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReplacement replaces characters Zabbix doesn't allow in item keys.
+const DefaultReplacement = "_"
+
+// hashLength is the number of hex characters of the key name hash appended to truncated keys.
+const hashLength = 8
+
+var (
+	invalidChars = regexp.MustCompile(`[^0-9a-z_.-]`)
+	validName    = regexp.MustCompile(`^[0-9a-z_.-]+$`)
+)
+
+// Config configures how alert names are turned into Zabbix item keys.
+type Config struct {
+	// Replacement replaces every character of the alertname Zabbix rejects in keys, defaults to "_".
+	Replacement string `yaml:"replacement"`
+	// MaxLength is the maximum length of the whole key including the prefix. Longer keys are truncated
+	// and suffixed with a hash of the key name. Zero disables truncation.
+	MaxLength int `yaml:"maxLength"`
+	// Aliases map alert names to key names, so renamed alerts can keep their existing Zabbix item.
+	Aliases map[string]string `yaml:"aliases"`
+}
+
+// Validate checks that replacement and aliases are valid key characters and that truncated keys fit the hash.
+func (c *Config) Validate() error {
+	if c.Replacement != "" && !validName.MatchString(c.Replacement) {
+		return errors.Errorf("replacement: %q contains characters not allowed in keys", c.Replacement)
+	}
+
+	if c.MaxLength < 0 || c.MaxLength > 0 && c.MaxLength <= hashLength+2 {
+		return errors.Errorf("maxLength: must be zero or greater than %d, got %d", hashLength+2, c.MaxLength)
+	}
+
+	for name, alias := range c.Aliases {
+		if !validName.MatchString(alias) {
+			return errors.Errorf("aliases: key name %q of alert %q must be lower case letters, digits, '_', '-' or '.'", alias, name)
+		}
+	}
+
+	return nil
+}
+
+// Key returns the Zabbix item key of the alert, the prefix and the key name are joined with a dot.
+func (c *Config) Key(prefix, alertname string) string {
+	return c.SuffixedKey(prefix, alertname, "")
+}
+
+// SuffixedKey returns the key of an item next to the item of the alert, the suffix is joined to its key
+// with a dot. Truncated keys keep the prefix and the suffix, unless the suffix leaves no room for the hash.
+func (c *Config) SuffixedKey(prefix, alertname, suffix string) string {
+	name, ok := c.Aliases[alertname]
+	if !ok {
+		name = c.sanitize(alertname)
+	}
+
+	if suffix != "" {
+		suffix = "." + suffix
+	}
+
+	key := prefix + "." + name + suffix
+	if c.MaxLength == 0 || len(key) <= c.MaxLength {
+		return key
+	}
+
+	// the key name is hashed, so aliased alerts keep the key of the alias
+	hash := hashSuffix(name)
+
+	keep := c.MaxLength - len(prefix) - 1 - len(hash) - len(suffix)
+	if keep < 0 {
+		// the suffix leaves no room for the name, so both are truncated together and suffixed with the hash
+		// of both, the key keeps the prefix and stays unique to the suffix
+		name, suffix = name+suffix, ""
+		hash = hashSuffix(name)
+		keep = c.MaxLength - len(prefix) - 1 - len(hash)
+		if keep < 0 {
+			// prefixes of notifications are not validated with ValidatePrefix
+			keep = 0
+		}
+	}
+
+	return prefix + "." + name[:keep] + hash + suffix
+}
+
+// ValidatePrefix checks that truncated keys fit the prefix and the hash.
+func (c *Config) ValidatePrefix(prefix string) error {
+	if c.MaxLength > 0 && len(prefix)+1+len(hashSuffix("")) > c.MaxLength {
+		return errors.Errorf("maxLength: must leave room for key prefix %q and the hash, got %d", prefix, c.MaxLength)
+	}
+	return nil
+}
+
+// SanitizeKey sanitizes a whole item key, like keys templated from remote_write series labels. Characters
+// Zabbix rejects in the key name are replaced, while parameters in brackets are kept. Longer keys are
+// truncated and suffixed with a hash of the key, parameters are truncated too when they leave no room for the hash.
+func (c *Config) SanitizeKey(key string) string {
+	name, params := key, ""
+	if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+		name, params = key[:i], key[i:]
+	}
+
+	name = c.sanitize(name)
+	if c.MaxLength == 0 || len(name)+len(params) <= c.MaxLength {
+		return name + params
+	}
+
+	hash := hashSuffix(key)
+	if len(hash)+len(params) >= c.MaxLength {
+		name, params = c.sanitize(key), ""
+	}
+
+	return truncate(name, c.MaxLength-len(hash)-len(params)) + hash + params
+}
+
+// truncate cuts s to at most n bytes on a rune boundary.
+func truncate(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// sanitize lower cases the name and replaces characters Zabbix doesn't allow in keys.
+func (c *Config) sanitize(name string) string {
+	replacement := c.Replacement
+	if replacement == "" {
+		replacement = DefaultReplacement
+	}
+	return invalidChars.ReplaceAllLiteralString(strings.ToLower(name), replacement)
+}
+
+// hashSuffix returns the suffix of truncated keys identifying the original name.
+func hashSuffix(name string) string {
+	sum := sha1.Sum([]byte(name))
+	return "_" + hex.EncodeToString(sum[:])[:hashLength]
+}
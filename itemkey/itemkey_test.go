@@ -0,0 +1,118 @@
+package itemkey_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/devopyio/zabbix-alertmanager/itemkey"
+)
+
+func TestKey(t *testing.T) {
+	long := strings.Repeat("VeryLongAlertName", 20)
+
+	for _, tc := range []struct {
+		cfg       itemkey.Config
+		alertname string
+		key       string
+	}{
+		{alertname: "InstanceDown", key: "prometheus.instancedown"},
+		{alertname: "Disk full: /var [90%]", key: "prometheus.disk_full___var__90__"},
+		{cfg: itemkey.Config{Replacement: "-"}, alertname: "Disk full", key: "prometheus.disk-full"},
+		{cfg: itemkey.Config{Aliases: map[string]string{"HostDown": "instancedown"}}, alertname: "HostDown", key: "prometheus.instancedown"},
+		{cfg: itemkey.Config{MaxLength: 255}, alertname: "InstanceDown", key: "prometheus.instancedown"},
+		{cfg: itemkey.Config{MaxLength: 30}, alertname: long, key: "prometheus.verylongal_65244cfa"},
+		{cfg: itemkey.Config{MaxLength: 30}, alertname: long + "2", key: "prometheus.verylongal_8b79d985"},
+		// the aliased name is hashed, so a renamed alert keeps its truncated key
+		{cfg: itemkey.Config{MaxLength: 30, Aliases: map[string]string{"Renamed": strings.ToLower(long)}}, alertname: "Renamed", key: "prometheus.verylongal_65244cfa"},
+	} {
+		if key := tc.cfg.Key("prometheus", tc.alertname); key != tc.key {
+			t.Errorf("Expected key %q of %q, got %q", tc.key, tc.alertname, key)
+		}
+	}
+}
+
+func TestSuffixedKey(t *testing.T) {
+	long := strings.Repeat("VeryLongAlertName", 20)
+
+	cfg := itemkey.Config{MaxLength: 36}
+	if key := cfg.SuffixedKey("prometheus", "InstanceDown", "value"); key != "prometheus.instancedown.value" {
+		t.Errorf("Expected key prometheus.instancedown.value, got %q", key)
+	}
+
+	// the name is truncated, the hash and the suffix are kept
+	key := cfg.SuffixedKey("prometheus", long, "value")
+	if len(key) != cfg.MaxLength || !strings.HasSuffix(key, "_65244cfa.value") {
+		t.Errorf("Expected key of length %d ending with the hash and suffix, got %q", cfg.MaxLength, key)
+	}
+
+	// prefix and suffix leave no room for the name, the prefix and the hash of both are kept
+	cfg = itemkey.Config{MaxLength: 20}
+	key = cfg.SuffixedKey("prometheus", long, "value")
+	if len(key) != cfg.MaxLength || !strings.HasPrefix(key, "prometheus.") || key == cfg.SuffixedKey("prometheus", long, "") {
+		t.Errorf("Expected prefixed key of length %d, unique to the suffix, got %q", cfg.MaxLength, key)
+	}
+
+	// the suffix is longer than the key, it is truncated with the name
+	cfg = itemkey.Config{MaxLength: 36}
+	suffix := strings.Repeat("value", 10)
+	key = cfg.SuffixedKey("prometheus", "InstanceDown", suffix)
+	if key != "prometheus.instancedown.val_336c0d8f" {
+		t.Errorf("Expected prefixed key of length %d, got %q", cfg.MaxLength, key)
+	}
+	if other := cfg.SuffixedKey("prometheus", "InstanceDown", suffix+"s"); other == key {
+		t.Errorf("Expected keys unique to the suffix, got %q", other)
+	}
+}
+
+func TestSanitizeKey(t *testing.T) {
+	cfg := itemkey.Config{MaxLength: 30}
+	for key, want := range map[string]string{
+		"prometheus.Probe Success":   "prometheus.probe_success",
+		"prometheus.up[web1:9100]":   "prometheus.up[web1:9100]",
+		"prometheus.node_load[web1]": "prometheus.node_load[web1]",
+		// the name is truncated and the parameters are kept
+		"prometheus.node_cpu_seconds_total[0]": "prometheus.node_cp_eaf72b25[0]",
+		// parameters leaving no room for the hash are truncated with the name
+		"prometheus.up[" + strings.Repeat("web", 10) + "]": "prometheus.up_webwebw_57f4b944",
+	} {
+		if got := cfg.SanitizeKey(key); got != want {
+			t.Errorf("Expected key %q of %q, got %q", want, key, got)
+		}
+	}
+
+	// multibyte parameters are shorter once sanitized
+	cfg = itemkey.Config{MaxLength: 255}
+	for _, tc := range []struct {
+		key  string
+		want string
+	}{
+		{key: "a[жж]", want: "a[жж]"},
+		{key: "a[" + strings.Repeat("ж", 126) + "]", want: "a[" + strings.Repeat("ж", 126) + "]"},
+		{key: "a[" + strings.Repeat("ж", 200) + "]", want: "a" + strings.Repeat("_", 202) + "_4b01d08f"},
+		{key: strings.Repeat("b", 250) + "[жж]", want: strings.Repeat("b", 240) + "_b22de9f9[жж]"},
+	} {
+		got := cfg.SanitizeKey(tc.key)
+		if got != tc.want || len(got) > cfg.MaxLength || !utf8.ValidString(got) {
+			t.Errorf("Expected key %q of %q, got %q", tc.want, tc.key, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, cfg := range []itemkey.Config{
+		{Replacement: " "},
+		{MaxLength: -1},
+		{MaxLength: 10},
+		{Aliases: map[string]string{"HostDown": "Instance Down"}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", cfg)
+		}
+	}
+
+	cfg := itemkey.Config{Replacement: "_", MaxLength: 255, Aliases: map[string]string{"HostDown": "instancedown"}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected %+v to be valid, got %v", cfg, err)
+	}
+}
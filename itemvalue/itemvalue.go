@@ -0,0 +1,112 @@
+package itemvalue
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Encodings of alert status in trapper item values.
+const (
+	// Numeric sends 1 for firing and 0 for resolved alerts to unsigned items.
+	Numeric = "numeric"
+	// Severity sends the Zabbix severity number of the severity label for firing and 0 for resolved
+	// alerts to unsigned items. Not classified alerts are sent as information, as 0 means resolved.
+	Severity = "severity"
+	// String sends PROBLEM for firing and OK for resolved alerts to character items.
+	String = "string"
+	// JSON sends the alert as a JSON document to text items.
+	JSON = "json"
+)
+
+// Values of the String encoding.
+const (
+	Problem = "PROBLEM"
+	OK      = "OK"
+)
+
+// Alert is the alert encoded by the JSON encoding.
+type Alert struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    string            `json:"startsAt,omitempty"`
+	EndsAt      string            `json:"endsAt,omitempty"`
+}
+
+// Validate checks that the encoding is known, empty encoding is numeric.
+func Validate(encoding string) error {
+	switch encoding {
+	case "", Numeric, Severity, String, JSON:
+		return nil
+	}
+	return errors.Errorf("unknown value encoding %q, must be %s, %s, %s or %s", encoding, Numeric, Severity, String, JSON)
+}
+
+// Encode returns the item value of the alert.
+func Encode(encoding string, alert Alert) string {
+	firing := alert.Status == "firing"
+
+	switch encoding {
+	case Severity:
+		if !firing {
+			return "0"
+		}
+		if p := Priority(alert.Labels["severity"]); p > 0 {
+			return strconv.Itoa(p)
+		}
+		return "1"
+
+	case String:
+		if firing {
+			return Problem
+		}
+		return OK
+
+	case JSON:
+		b, err := json.Marshal(alert)
+		if err != nil {
+			// maps of strings always marshal
+			panic(err)
+		}
+		return string(b)
+
+	default:
+		if firing {
+			return "1"
+		}
+		return "0"
+	}
+}
+
+// Firing reports whether the item value of the encoding is a firing alert.
+func Firing(encoding, value string) bool {
+	switch encoding {
+	case String:
+		return value == Problem
+	case JSON:
+		return strings.HasPrefix(value, `{"status":"firing"`)
+	default:
+		return value != "0"
+	}
+}
+
+// Priority returns the Zabbix severity number of Prometheus severity label, 0 is not classified.
+func Priority(severity string) int {
+	switch strings.ToLower(severity) {
+	case "information", "info":
+		return 1
+	case "warning":
+		return 2
+	case "average":
+		return 3
+	case "high":
+		return 4
+	case "critical":
+		return 5
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,56 @@
+package itemvalue_test
+
+import (
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
+)
+
+func TestEncode(t *testing.T) {
+	firing := itemvalue.Alert{Status: "firing", Labels: map[string]string{"alertname": "DiskFull", "severity": "high"}}
+	resolved := itemvalue.Alert{Status: "resolved", Labels: map[string]string{"alertname": "DiskFull", "severity": "high"}}
+	unclassified := itemvalue.Alert{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}}
+
+	for _, tc := range []struct {
+		encoding string
+		alert    itemvalue.Alert
+		value    string
+	}{
+		{"", firing, "1"},
+		{itemvalue.Numeric, resolved, "0"},
+		{itemvalue.Severity, firing, "4"},
+		{itemvalue.Severity, resolved, "0"},
+		{itemvalue.Severity, unclassified, "1"},
+		{itemvalue.String, firing, "PROBLEM"},
+		{itemvalue.String, resolved, "OK"},
+		{itemvalue.JSON, firing, `{"status":"firing","labels":{"alertname":"DiskFull","severity":"high"}}`},
+	} {
+		if value := itemvalue.Encode(tc.encoding, tc.alert); value != tc.value {
+			t.Errorf("Expected %s encoding of %+v to be %s, got %s", tc.encoding, tc.alert, tc.value, value)
+		}
+		if firing := itemvalue.Firing(tc.encoding, tc.value); firing != (tc.alert.Status == "firing") {
+			t.Errorf("Expected %s value %s to be firing %v, got %v", tc.encoding, tc.value, tc.alert.Status == "firing", firing)
+		}
+	}
+
+	if err := itemvalue.Validate("boolean"); err == nil {
+		t.Error("Expected unknown encoding to be invalid")
+	}
+}
+
+func TestPriority(t *testing.T) {
+	for severity, priority := range map[string]int{
+		"":            0,
+		"none":        0,
+		"info":        1,
+		"Information": 1,
+		"warning":     2,
+		"average":     3,
+		"high":        4,
+		"critical":    5,
+	} {
+		if p := itemvalue.Priority(severity); p != priority {
+			t.Errorf("Expected priority %d of severity %q, got %d", priority, severity, p)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package itemvalue
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSampleSuffix is joined to the key of the alert item to name the item of its sample values.
+const DefaultSampleSuffix = "value"
+
+var validSuffix = regexp.MustCompile(`^[0-9a-z_.-]+$`)
+
+// SampleConfig configures forwarding of alert sample values, e.g. an annotation value: "{{ $value }}",
+// to float items next to the alert items. It is disabled unless the annotation or the label is set.
+type SampleConfig struct {
+	// Annotation holds the sample value.
+	Annotation string `yaml:"annotation"`
+	// Label holds the sample value of alerts without the annotation.
+	Label string `yaml:"label"`
+	// KeySuffix is joined to the key of the alert item with a dot, defaults to "value".
+	KeySuffix string `yaml:"keySuffix"`
+}
+
+// Enabled reports whether sample values are forwarded.
+func (c SampleConfig) Enabled() bool {
+	return c.Annotation != "" || c.Label != ""
+}
+
+// Validate checks that the key suffix is made of characters allowed in keys.
+func (c SampleConfig) Validate() error {
+	if c.KeySuffix != "" && !validSuffix.MatchString(c.KeySuffix) {
+		return errors.Errorf("keySuffix: %q must be lower case letters, digits, '_', '-' or '.'", c.KeySuffix)
+	}
+	return nil
+}
+
+// Suffix returns the key suffix of sample items.
+func (c SampleConfig) Suffix() string {
+	if c.KeySuffix == "" {
+		return DefaultSampleSuffix
+	}
+	return c.KeySuffix
+}
+
+// Declared reports whether a rule or an alert has the sample annotation or label.
+func (c SampleConfig) Declared(labels, annotations map[string]string) bool {
+	_, ok := c.raw(labels, annotations)
+	return ok
+}
+
+// Sample returns the sample value formatted for a float item. It is false when sampling is disabled
+// or the value is missing or not a finite number.
+func (c SampleConfig) Sample(labels, annotations map[string]string) (string, bool) {
+	raw, ok := c.raw(labels, annotations)
+	if !ok {
+		return "", false
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", false
+	}
+
+	return strconv.FormatFloat(f, 'f', -1, 64), true
+}
+
+// raw returns the annotation, or the label of alerts without the annotation.
+func (c SampleConfig) raw(labels, annotations map[string]string) (string, bool) {
+	if c.Annotation != "" {
+		if v, ok := annotations[c.Annotation]; ok {
+			return v, true
+		}
+	}
+	if c.Label != "" {
+		if v, ok := labels[c.Label]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,40 @@
+package itemvalue_test
+
+import (
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
+)
+
+func TestSample(t *testing.T) {
+	cfg := itemvalue.SampleConfig{Annotation: "value", Label: "value"}
+
+	for _, tc := range []struct {
+		labels      map[string]string
+		annotations map[string]string
+		value       string
+		ok          bool
+	}{
+		{annotations: map[string]string{"value": "0.25"}, value: "0.25", ok: true},
+		{annotations: map[string]string{"value": " 1e3 "}, value: "1000", ok: true},
+		{labels: map[string]string{"value": "-2"}, value: "-2", ok: true},
+		{labels: map[string]string{"value": "3"}, annotations: map[string]string{"value": "4"}, value: "4", ok: true},
+		{annotations: map[string]string{"value": "high"}},
+		{annotations: map[string]string{"value": "NaN"}},
+		{annotations: map[string]string{"value": "+Inf"}},
+		{annotations: map[string]string{"summary": "1"}},
+	} {
+		value, ok := cfg.Sample(tc.labels, tc.annotations)
+		if value != tc.value || ok != tc.ok {
+			t.Errorf("Expected sample of %v %v to be %q %v, got %q %v", tc.labels, tc.annotations, tc.value, tc.ok, value, ok)
+		}
+	}
+
+	if _, ok := (itemvalue.SampleConfig{}).Sample(nil, map[string]string{"value": "1"}); ok {
+		t.Error("Expected no sample when sampling is disabled")
+	}
+
+	if err := (itemvalue.SampleConfig{KeySuffix: "Value"}).Validate(); err == nil {
+		t.Error("Expected upper case key suffix to be invalid")
+	}
+}
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// ExporterOTLP sends spans to an OTLP http collector.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to standard output.
+	ExporterStdout = "stdout"
+)
+
+// Config configures OpenTelemetry tracing.
+type Config struct {
+	// Exporter is otlp or stdout, empty disables tracing.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is host:port of the OTLP http collector, defaults to OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends spans to the collector over plain http.
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio is the ratio of new traces which are sampled, traces of incoming requests follow the parent decision.
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// Validate checks the exporter and the sample ratio.
+func (c *Config) Validate() error {
+	switch c.Exporter {
+	case "", ExporterOTLP, ExporterStdout:
+	default:
+		return errors.Errorf("exporter: must be %s or %s, got %q", ExporterOTLP, ExporterStdout, c.Exporter)
+	}
+
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return errors.Errorf("sampleRatio: must be between 0 and 1, got %v", c.SampleRatio)
+	}
+
+	return nil
+}
+
+// Setup installs global tracer provider and W3C trace context propagator.
+// The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg Config, version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+
+	default:
+		err = errors.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating trace exporter")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "zal"),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
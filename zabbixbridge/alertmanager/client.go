@@ -0,0 +1,162 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Matcher matches alert labels, https://github.com/prometheus/alertmanager/blob/master/api/v2/openapi.yaml
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual *bool  `json:"isEqual,omitempty"`
+}
+
+// SilenceStatus is state of the silence: expired, active or pending.
+type SilenceStatus struct {
+	State string `json:"state"`
+}
+
+const (
+	SilenceActive  = "active"
+	SilencePending = "pending"
+	SilenceExpired = "expired"
+)
+
+// Silence is Alertmanager silence.
+type Silence struct {
+	ID        string         `json:"id,omitempty"`
+	Matchers  []Matcher      `json:"matchers"`
+	StartsAt  time.Time      `json:"startsAt"`
+	EndsAt    time.Time      `json:"endsAt"`
+	CreatedBy string         `json:"createdBy"`
+	Comment   string         `json:"comment"`
+	Status    *SilenceStatus `json:"status,omitempty"`
+}
+
+// Active reports whether silence is active or pending.
+func (s *Silence) Active() bool {
+	return s.Status == nil || s.Status.State != SilenceExpired
+}
+
+// Alert is alert posted to Alertmanager.
+type Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt,omitempty"`
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// Client calls Alertmanager v2 api.
+type Client struct {
+	url string
+	c   *http.Client
+}
+
+// New creates Alertmanager client, url is Alertmanager base url, e.g. http://alertmanager:9093.
+func New(url string, c *http.Client) *Client {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	return &Client{
+		url: strings.TrimSuffix(url, "/"),
+		c:   c,
+	}
+}
+
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return errors.Wrap(err, "can't encode request")
+		}
+	}
+
+	req, err := http.NewRequest(method, c.url+path, &body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.c.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed", method, path)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s failed reading response", method, path)
+	}
+
+	if res.StatusCode/100 != 2 {
+		return errors.Errorf("%s %s failed, status: %d, response: %s", method, path, res.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return errors.Wrapf(err, "%s %s failed decoding response", method, path)
+	}
+
+	return nil
+}
+
+// Silences lists silences, optionally filtered by matchers like `alertname="foo"`.
+func (c *Client) Silences(filter ...string) ([]Silence, error) {
+	path := "/api/v2/silences"
+	if len(filter) != 0 {
+		q := url.Values{}
+		for _, f := range filter {
+			q.Add("filter", f)
+		}
+		path += "?" + q.Encode()
+	}
+
+	var silences []Silence
+	if err := c.do(http.MethodGet, path, nil, &silences); err != nil {
+		return nil, err
+	}
+
+	return silences, nil
+}
+
+// PostSilence creates silence, or updates it when ID is set, and returns its ID.
+func (c *Client) PostSilence(s *Silence) (string, error) {
+	in := *s
+	in.Status = nil
+
+	var res struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := c.do(http.MethodPost, "/api/v2/silences", &in, &res); err != nil {
+		return "", err
+	}
+
+	return res.SilenceID, nil
+}
+
+// ExpireSilence expires silence by ID.
+func (c *Client) ExpireSilence(id string) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("/api/v2/silence/%s", url.PathEscape(id)), nil, nil)
+}
+
+// PostAlerts posts alerts, alerts are resolved when endsAt passes.
+func (c *Client) PostAlerts(alerts []Alert) error {
+	return c.do(http.MethodPost, "/api/v2/alerts", alerts, nil)
+}
@@ -0,0 +1,137 @@
+package bridge
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/alertmanager"
+	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
+	"github.com/pkg/errors"
+)
+
+const ackSync = "ack"
+
+// SyncAcks creates Alertmanager silences for acknowledged problems of zal managed triggers.
+// Silences are extended while problems stay acknowledged and expired when problems are resolved
+// or unacknowledged.
+func (b *Bridge) SyncAcks() error {
+	hosts, err := b.hostIds()
+	if err != nil {
+		return err
+	}
+
+	silences, err := b.silences(ackSync)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{}
+	if len(hosts) != 0 {
+		if err := b.silenceAcks(hosts, silences, keep); err != nil {
+			return err
+		}
+	}
+
+	return b.expireSilences(ackSync, silences, keep)
+}
+
+func (b *Bridge) silenceAcks(hosts map[string]string, silences map[string]alertmanager.Silence, keep map[string]bool) error {
+	hostIds := make([]string, 0, len(hosts))
+	for id := range hosts {
+		hostIds = append(hostIds, id)
+	}
+	sort.Strings(hostIds)
+
+	problems, err := b.api.ProblemsGet(zabbix.Params{
+		"hostids":            hostIds,
+		"source":             0,
+		"object":             0,
+		"acknowledged":       true,
+		"selectAcknowledges": "extend",
+	})
+	if err != nil {
+		return errors.Wrap(err, "error getting zabbix problems")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	triggerIds := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		triggerIds = append(triggerIds, problem.ObjectId)
+	}
+
+	triggers, err := b.managedTriggers(zabbix.Params{"triggerids": triggerIds})
+	if err != nil {
+		return err
+	}
+
+	now := b.now()
+	for _, problem := range problems {
+		trigger, ok := triggers[problem.ObjectId]
+		if !ok {
+			continue
+		}
+
+		ack, ok := lastAcknowledge(problem.Acknowledges)
+		if !ok {
+			continue
+		}
+		hostMatchers, ok := b.hostMatchers(trigger.Host)
+		if !ok {
+			continue
+		}
+		keep[problem.EventId] = true
+
+		s := alertmanager.Silence{
+			Matchers:  append([]alertmanager.Matcher{alertNameMatcher(trigger.AlertName)}, hostMatchers...),
+			StartsAt:  now,
+			EndsAt:    now.Add(b.ackSilenceDuration),
+			CreatedBy: CreatedBy,
+			Comment:   ackComment(trigger, problem.EventId, ack),
+		}
+
+		action := "created"
+		if existing, ok := silences[problem.EventId]; ok {
+			// Extend the silence when half of its duration passed, or update it with the latest acknowledge.
+			if existing.Comment == s.Comment && sameMatchers(existing.Matchers, s.Matchers) && existing.EndsAt.Sub(now) > b.ackSilenceDuration/2 {
+				continue
+			}
+			s.ID = existing.ID
+			s.StartsAt = existing.StartsAt
+			action = "extended"
+		}
+
+		if err := b.postSilence(ackSync, action, &s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lastAcknowledge returns the latest acknowledge action of the problem.
+func lastAcknowledge(acks []zabbix.Acknowledge) (zabbix.Acknowledge, bool) {
+	var last zabbix.Acknowledge
+	var found bool
+	for _, ack := range acks {
+		// Zabbix before 4.0 doesn't return action.
+		if ack.Action != 0 && ack.Action&zabbix.ActionAcknowledge == 0 {
+			continue
+		}
+		if !found || ack.Clock >= last.Clock {
+			last = ack
+			found = true
+		}
+	}
+	return last, found
+}
+
+func ackComment(trigger managedTrigger, eventId string, ack zabbix.Acknowledge) string {
+	comment := fmt.Sprintf("Acknowledged in Zabbix by %s", ack.User())
+	if ack.Message != "" {
+		comment += ": " + ack.Message
+	}
+	return fmt.Sprintf("%s (host %s, trigger %s) %s", comment, trigger.Host, trigger.Description, marker(ackSync, eventId))
+}
@@ -0,0 +1,197 @@
+package bridge_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/bridge"
+)
+
+func TestSyncAcks(t *testing.T) {
+	z := newFakeZabbix(t)
+	am := newFakeAlertmanager(t)
+
+	z.set("host.get", []map[string]interface{}{{"hostid": "10", "host": "infra"}})
+	z.set("trigger.get", []map[string]interface{}{
+		{"triggerid": "100", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0"},
+		{"triggerid": "101", "description": "DiskFull", "expression": "last(/infra/prometheus.diskfull)<>0"},
+		{"triggerid": "102", "description": "Agent", "expression": "{infra:agent.ping.nodata(60)}=1"},
+	})
+	problems := []map[string]interface{}{
+		{
+			"eventid": "1000", "objectid": "100", "acknowledged": "1",
+			"acknowledges": []map[string]interface{}{
+				{"acknowledgeid": "1", "clock": "10", "action": "2", "message": "old", "alias": "noc"},
+				{"acknowledgeid": "2", "clock": "20", "action": "6", "message": "looking into it", "alias": "noc"},
+			},
+		},
+		{
+			"eventid": "1001", "objectid": "101", "acknowledged": "1",
+			"acknowledges": []map[string]interface{}{
+				{"acknowledgeid": "3", "clock": "30", "action": "2", "username": "admin"},
+			},
+		},
+		{
+			"eventid": "1002", "objectid": "102", "acknowledged": "1",
+			"acknowledges": []map[string]interface{}{
+				{"acknowledgeid": "4", "clock": "40", "action": "2", "username": "admin"},
+			},
+		},
+	}
+	z.set("problem.get", problems)
+
+	b := bridge.New(bridge.Config{
+		ZabbixURL:          z.URL,
+		User:               "zal",
+		Password:           "secret",
+		AlertmanagerURL:    am.URL,
+		KeyPrefix:          "prometheus",
+		Hosts:              []string{"infra"},
+		AckSilenceDuration: time.Hour,
+		HostLabel:          "zabbix_host",
+	})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	silences := am.active()
+	if len(silences) != 2 {
+		t.Fatalf("Expected 2 silences, got %+v", silences)
+	}
+
+	for _, s := range silences {
+		if s.CreatedBy != bridge.CreatedBy || len(s.Matchers) != 2 || !s.Matchers[0].IsRegex {
+			t.Fatalf("Unexpected silence: %+v", s)
+		}
+		if host := s.Matchers[1]; host.Name != "zabbix_host" || host.Value != "infra" || host.IsRegex {
+			t.Fatalf("Unexpected silence: %+v", s)
+		}
+		if time.Until(s.EndsAt) < 59*time.Minute {
+			t.Fatalf("Expected silence to last an hour, ends at %s", s.EndsAt)
+		}
+
+		switch s.Matchers[0].Value {
+		case "(?i)highcpu":
+			if !strings.Contains(s.Comment, "by noc: looking into it") || !strings.Contains(s.Comment, "[zal:ack:1000]") {
+				t.Fatalf("Unexpected comment: %s", s.Comment)
+			}
+		case "(?i)diskfull":
+			if !strings.Contains(s.Comment, "by admin") || !strings.Contains(s.Comment, "[zal:ack:1001]") {
+				t.Fatalf("Unexpected comment: %s", s.Comment)
+			}
+		default:
+			t.Fatalf("Unexpected matcher: %+v", s.Matchers[0])
+		}
+	}
+
+	calls := z.called("problem.get")
+	if len(calls) != 1 || calls[0].(map[string]interface{})["acknowledged"] != true {
+		t.Fatalf("Expected acknowledged problems to be requested, got %+v", calls)
+	}
+
+	// Silences are not extended before half of their duration passes.
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if am.postCount() != 2 {
+		t.Fatalf("Expected silences not to be reposted, got %d posts", am.postCount())
+	}
+
+	// Resolved problem expires its silence.
+	z.set("problem.get", problems[:1])
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	silences = am.active()
+	if len(silences) != 1 || silences[0].Matchers[0].Value != "(?i)highcpu" {
+		t.Fatalf("Expected only highcpu silence, got %+v", silences)
+	}
+}
+
+func TestSyncAcksExtends(t *testing.T) {
+	z := newFakeZabbix(t)
+	am := newFakeAlertmanager(t)
+
+	z.set("host.get", []map[string]interface{}{{"hostid": "10", "host": "infra"}})
+	z.set("trigger.get", []map[string]interface{}{
+		{"triggerid": "100", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0"},
+	})
+	z.set("problem.get", []map[string]interface{}{{
+		"eventid": "1000", "objectid": "100", "acknowledged": "1",
+		"acknowledges": []map[string]interface{}{{"acknowledgeid": "1", "clock": "10", "action": "2", "alias": "noc"}},
+	}})
+
+	// Half of the duration passes between syncs.
+	b := bridge.New(bridge.Config{
+		ZabbixURL:          z.URL,
+		AlertmanagerURL:    am.URL,
+		KeyPrefix:          "prometheus",
+		Hosts:              []string{"infra"},
+		AckSilenceDuration: time.Millisecond,
+		GlobalSilences:     true,
+	})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	silences := am.active()
+	if len(silences) != 1 || am.postCount() != 2 {
+		t.Fatalf("Expected one silence to be extended, got %d posts of %+v", am.postCount(), silences)
+	}
+}
+
+func TestSyncAcksGlobalSilences(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		global   bool
+		silences int
+	}{
+		{name: "disabled", global: false, silences: 0},
+		{name: "enabled", global: true, silences: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			z := newFakeZabbix(t)
+			am := newFakeAlertmanager(t)
+
+			z.set("host.get", []map[string]interface{}{{"hostid": "10", "host": "infra"}})
+			z.set("trigger.get", []map[string]interface{}{
+				{"triggerid": "100", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0"},
+			})
+			z.set("problem.get", []map[string]interface{}{{
+				"eventid": "1000", "objectid": "100", "acknowledged": "1",
+				"acknowledges": []map[string]interface{}{{"acknowledgeid": "1", "clock": "10", "action": "2", "alias": "noc"}},
+			}})
+
+			b := bridge.New(bridge.Config{
+				ZabbixURL:          z.URL,
+				AlertmanagerURL:    am.URL,
+				KeyPrefix:          "prometheus",
+				Hosts:              []string{"infra"},
+				AckSilenceDuration: time.Hour,
+				GlobalSilences:     tc.global,
+			})
+
+			if err := b.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			silences := am.active()
+			if len(silences) != tc.silences {
+				t.Fatalf("Expected %d silences, got %+v", tc.silences, silences)
+			}
+			for _, s := range silences {
+				if len(s.Matchers) != 1 || s.Matchers[0].Value != "(?i)highcpu" {
+					t.Fatalf("Unexpected matchers: %+v", s.Matchers)
+				}
+			}
+		})
+	}
+}
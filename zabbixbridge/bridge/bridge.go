@@ -0,0 +1,400 @@
+package bridge
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/alertmanager"
+	"github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/provisioner"
+	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreatedBy is the author of silences managed by the bridge.
+const CreatedBy = "zal"
+
+// DefaultTimeout limits Zabbix and Alertmanager api requests, so a hanging server doesn't stop the syncs.
+const DefaultTimeout = 30 * time.Second
+
+var (
+	syncErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bridge_sync_errors_total",
+			Help: "Number of failed bridge syncs",
+		},
+		[]string{"sync"},
+	)
+
+	silencesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "bridge_silences_total",
+			Help: "Number of Alertmanager silences changed by the bridge",
+		},
+		[]string{"sync", "action"},
+	)
+)
+
+// Config configures the bridge between Zabbix and Alertmanager.
+type Config struct {
+	ZabbixURL       string
+	User            string
+	Password        string
+	AlertmanagerURL string
+	// Transport is used for Zabbix api calls, nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+	// Timeout limits each Zabbix and Alertmanager api request, zero uses DefaultTimeout.
+	Timeout   time.Duration
+	KeyPrefix string
+	// Hosts are the zal managed Zabbix hosts.
+	Hosts []string
+	// AckSilenceDuration is how long silences of acknowledged problems last, they are
+	// extended while the problem stays acknowledged. Zero disables the ack sync.
+	AckSilenceDuration time.Duration
+	// HostLabel is the alert label holding the Zabbix host name. Silences of acknowledged problems
+	// and maintenances match it, so they only silence alerts of the host.
+	HostLabel string
+	// GlobalSilences allows silences without HostLabel, they silence the alertnames on all hosts.
+	GlobalSilences bool
+	// MaintenanceSilences enables silences of alerts of hosts in Zabbix maintenance.
+	MaintenanceSilences bool
+	// SilenceMaintenances enables Zabbix maintenances for Alertmanager silences of zal managed triggers.
+	SilenceMaintenances bool
+	// Location is the Zabbix server time zone, used to evaluate maintenance periods. Nil uses time.Local.
+	Location *time.Location
+	// PullProblems enables alerts of Zabbix problems of triggers not managed by zal.
+	PullProblems bool
+	// ResolveTimeout is the end time of pulled alerts, they are refreshed on every sync.
+	ResolveTimeout time.Duration
+	// HostGroups limits pulled problems to hosts of the groups, empty pulls problems of all hosts.
+	HostGroups []string
+}
+
+// Bridge syncs state between Zabbix and Alertmanager.
+type Bridge struct {
+	api       *zabbix.API
+	zabbixURL string
+	am        *alertmanager.Client
+	user      string
+	password  string
+	keyPrefix string
+	hosts     []string
+
+	ackSilenceDuration  time.Duration
+	hostLabel           string
+	globalSilences      bool
+	maintenanceSilences bool
+	silenceMaintenances bool
+	location            *time.Location
+	pullProblems        bool
+	resolveTimeout      time.Duration
+	hostGroups          []string
+
+	// synced keeps state of silences mirrored to maintenances by silence id.
+	synced map[string]syncedSilence
+	// pulled keeps firing alerts of Zabbix problems by event id.
+	pulled map[string]alertmanager.Alert
+
+	now func() time.Time
+}
+
+// New creates the bridge, Zabbix api login happens on the first sync.
+func New(cfg Config) *Bridge {
+	transport := cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	location := cfg.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	api := zabbix.NewAPI(cfg.ZabbixURL)
+	api.SetClient(&http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	})
+
+	return &Bridge{
+		api:                 api,
+		zabbixURL:           cfg.ZabbixURL,
+		am:                  alertmanager.New(cfg.AlertmanagerURL, &http.Client{Timeout: timeout}),
+		user:                cfg.User,
+		password:            cfg.Password,
+		keyPrefix:           strings.ToLower(cfg.KeyPrefix),
+		hosts:               cfg.Hosts,
+		ackSilenceDuration:  cfg.AckSilenceDuration,
+		hostLabel:           cfg.HostLabel,
+		globalSilences:      cfg.GlobalSilences,
+		maintenanceSilences: cfg.MaintenanceSilences,
+		silenceMaintenances: cfg.SilenceMaintenances,
+		location:            location,
+		pullProblems:        cfg.PullProblems,
+		resolveTimeout:      cfg.ResolveTimeout,
+		hostGroups:          cfg.HostGroups,
+		synced:              map[string]syncedSilence{},
+		pulled:              map[string]alertmanager.Alert{},
+		now:                 time.Now,
+	}
+}
+
+type syncFunc struct {
+	name string
+	fn   func() error
+}
+
+func (b *Bridge) syncs() []syncFunc {
+	var syncs []syncFunc
+	if b.ackSilenceDuration > 0 {
+		syncs = append(syncs, syncFunc{ackSync, b.SyncAcks})
+	}
+	if b.maintenanceSilences {
+		syncs = append(syncs, syncFunc{maintenanceSync, b.SyncMaintenances})
+	}
+	if b.silenceMaintenances {
+		syncs = append(syncs, syncFunc{silenceSync, b.SyncSilences})
+	}
+	if b.pullProblems {
+		syncs = append(syncs, syncFunc{pullSync, b.SyncProblems})
+	}
+	return syncs
+}
+
+// Sync runs all enabled syncs once and returns the first error.
+func (b *Bridge) Sync() error {
+	if b.api.Auth == "" {
+		if _, err := b.api.Login(b.user, b.password); err != nil {
+			return errors.Wrap(err, "error while login to zabbix api")
+		}
+	}
+
+	var firstErr error
+	for _, s := range b.syncs() {
+		if err := s.fn(); err != nil {
+			syncErrorsTotal.WithLabelValues(s.name).Inc()
+
+			// Zabbix api errors include expired sessions, login again on the next sync.
+			if _, ok := errors.Cause(err).(*zabbix.Error); ok {
+				b.api.Auth = ""
+			}
+
+			err = errors.Wrapf(err, "%s sync failed", s.name)
+			log.Error(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// Run syncs every interval until stop is closed.
+func (b *Bridge) Run(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		// errors are logged by Sync
+		_ = b.Sync()
+
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// hostIds resolves managed host names to Zabbix host ids.
+func (b *Bridge) hostIds() (map[string]string, error) {
+	hosts, err := b.api.HostsGet(zabbix.Params{
+		"output": []string{"hostid", "host"},
+		"filter": map[string][]string{"host": b.hosts},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix hosts")
+	}
+
+	ids := make(map[string]string, len(hosts))
+	for _, host := range hosts {
+		ids[host.HostId] = host.Host
+	}
+
+	return ids, nil
+}
+
+var (
+	// {host:key.func(...)} used before Zabbix 5.4 and by zal prov.
+	oldExpression = regexp.MustCompile(`\{([^:{}]+):([^{}]+)\.[a-z]+\(`)
+	// func(/host/key...) used since Zabbix 5.4.
+	newExpression = regexp.MustCompile(`[a-z]+\(/([^/]+)/([^,)]+)`)
+)
+
+// triggerKey returns host and item key of the first item referenced in the trigger expression.
+func triggerKey(expression string) (host, key string, ok bool) {
+	for _, re := range []*regexp.Regexp{oldExpression, newExpression} {
+		if m := re.FindStringSubmatch(expression); m != nil {
+			return m[1], m[2], true
+		}
+	}
+	return "", "", false
+}
+
+// alertName returns the alertname of zal managed item key.
+func (b *Bridge) alertName(key string) (string, bool) {
+	prefix := b.keyPrefix + "."
+	if !strings.HasPrefix(key, prefix) || len(key) == len(prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(key, prefix), true
+}
+
+// alertNameMatcher matches alertname case insensitively, because keys are lower case.
+func alertNameMatcher(name string) alertmanager.Matcher {
+	return alertmanager.Matcher{
+		Name:    "alertname",
+		Value:   "(?i)" + regexp.QuoteMeta(name),
+		IsRegex: true,
+	}
+}
+
+// hostMatchers returns matchers limiting a silence to alerts of the host. It returns false when
+// the host label isn't set and global silences aren't allowed, then no silence is created.
+func (b *Bridge) hostMatchers(host string) ([]alertmanager.Matcher, bool) {
+	if b.hostLabel == "" {
+		return nil, b.globalSilences
+	}
+	return []alertmanager.Matcher{{Name: b.hostLabel, Value: host}}, true
+}
+
+// managedTrigger is zal provisioned trigger.
+type managedTrigger struct {
+	zabbix.Trigger
+	Host      string
+	AlertName string
+}
+
+// managedTriggers returns zal provisioned triggers by trigger id.
+func (b *Bridge) managedTriggers(params zabbix.Params) (map[string]managedTrigger, error) {
+	params["output"] = []string{"triggerid", "description", "expression", "priority", "value"}
+	params["expandExpression"] = true
+	params["selectTags"] = "extend"
+
+	triggers, err := b.api.TriggersGet(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix triggers")
+	}
+
+	managed := make(map[string]managedTrigger, len(triggers))
+	for _, trigger := range triggers {
+		host, key, ok := triggerKey(trigger.Expression)
+		if !ok {
+			continue
+		}
+
+		name, ok := b.alertName(key)
+		if !ok {
+			continue
+		}
+		// keys may be sanitized or aliased, the tag keeps the original alertname
+		for _, tag := range trigger.Tags {
+			if tag.Tag == provisioner.AlertNameTag && tag.Value != "" {
+				name = tag.Value
+			}
+		}
+
+		managed[trigger.TriggerId] = managedTrigger{
+			Trigger:   trigger,
+			Host:      host,
+			AlertName: name,
+		}
+	}
+
+	return managed, nil
+}
+
+// silences returns active silences created by the bridge with the marker kind, keyed by marker id.
+// Duplicate silences of the same marker are expired.
+func (b *Bridge) silences(kind string) (map[string]alertmanager.Silence, error) {
+	silences, err := b.am.Silences()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting alertmanager silences")
+	}
+
+	res := map[string]alertmanager.Silence{}
+	for _, s := range silences {
+		if s.CreatedBy != CreatedBy || !s.Active() {
+			continue
+		}
+
+		id, ok := parseMarker(s.Comment, kind)
+		if !ok {
+			continue
+		}
+
+		if dup, ok := res[id]; ok {
+			log.Warnf("expiring duplicate silence %s of %s", dup.ID, marker(kind, id))
+			if err := b.am.ExpireSilence(dup.ID); err != nil {
+				return nil, errors.Wrapf(err, "error expiring duplicate silence %s", dup.ID)
+			}
+		}
+		res[id] = s
+	}
+
+	return res, nil
+}
+
+// marker identifies Zabbix object of the silence in the silence comment.
+func marker(kind, id string) string {
+	return "[zal:" + kind + ":" + id + "]"
+}
+
+var markerRegexp = regexp.MustCompile(`\[zal:([a-z]+):([^\]]+)\]`)
+
+func parseMarker(comment, kind string) (string, bool) {
+	m := markerRegexp.FindStringSubmatch(comment)
+	if m == nil || m[1] != kind {
+		return "", false
+	}
+	return m[2], true
+}
+
+// expireSilences expires silences which are not wanted anymore.
+func (b *Bridge) expireSilences(sync string, silences map[string]alertmanager.Silence, keep map[string]bool) error {
+	for id, s := range silences {
+		if keep[id] {
+			continue
+		}
+
+		if err := b.am.ExpireSilence(s.ID); err != nil {
+			return errors.Wrapf(err, "error expiring silence %s", s.ID)
+		}
+		silencesTotal.WithLabelValues(sync, "expired").Inc()
+		log.Infof("expired silence %s of %s", s.ID, marker(sync, id))
+	}
+
+	return nil
+}
+
+// postSilence creates or updates silence.
+func (b *Bridge) postSilence(sync, action string, s *alertmanager.Silence) error {
+	id, err := b.am.PostSilence(s)
+	if err != nil {
+		return errors.Wrap(err, "error posting silence")
+	}
+	silencesTotal.WithLabelValues(sync, action).Inc()
+	log.Infof("%s silence %s: %s", action, id, s.Comment)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package bridge_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/bridge"
+)
+
+func TestSyncTimeout(t *testing.T) {
+	// the server answers only when the test ends
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	for _, urls := range [][2]string{{hanging.URL, newFakeAlertmanager(t).URL}, {newFakeZabbix(t).URL, hanging.URL}} {
+		b := bridge.New(bridge.Config{
+			ZabbixURL:          urls[0],
+			AlertmanagerURL:    urls[1],
+			KeyPrefix:          "prometheus",
+			Hosts:              []string{"infra"},
+			AckSilenceDuration: time.Hour,
+			GlobalSilences:     true,
+			Timeout:            50 * time.Millisecond,
+		})
+
+		start := time.Now()
+		if err := b.Sync(); err == nil {
+			t.Fatalf("Expected sync with hanging %v to fail", urls)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("Expected requests to time out, took %s", elapsed)
+		}
+	}
+}
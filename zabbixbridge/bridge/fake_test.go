@@ -0,0 +1,217 @@
+package bridge_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/alertmanager"
+)
+
+// fakeZabbix serves Zabbix json rpc api, results are returned by method.
+type fakeZabbix struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	results map[string]interface{}
+	calls   map[string][]interface{}
+}
+
+func newFakeZabbix(t *testing.T) *fakeZabbix {
+	z := &fakeZabbix{
+		results: map[string]interface{}{"user.login": "token"},
+		calls:   map[string][]interface{}{},
+	}
+
+	z.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			ID     int             `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid zabbix request: %v", err)
+			return
+		}
+
+		// create, update and delete methods receive arrays
+		var params interface{}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			t.Errorf("invalid zabbix params: %v", err)
+			return
+		}
+
+		z.mu.Lock()
+		z.calls[req.Method] = append(z.calls[req.Method], params)
+		result, ok := z.results[req.Method]
+		z.mu.Unlock()
+
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result}
+		if fn, isFn := result.(func(params interface{}) interface{}); isFn {
+			res["result"] = fn(params)
+		}
+		if !ok {
+			res["result"] = []interface{}{}
+		}
+
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			t.Errorf("can't encode zabbix response: %v", err)
+		}
+	}))
+	t.Cleanup(z.Close)
+
+	return z
+}
+
+func (z *fakeZabbix) set(method string, result interface{}) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.results[method] = result
+}
+
+// called returns params of the method calls.
+func (z *fakeZabbix) called(method string) []interface{} {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.calls[method]
+}
+
+// fakeAlertmanager serves Alertmanager silences and alerts api.
+type fakeAlertmanager struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	silences map[string]*alertmanager.Silence
+	posts    int
+	alerts   [][]alertmanager.Alert
+}
+
+func newFakeAlertmanager(t *testing.T) *fakeAlertmanager {
+	am := &fakeAlertmanager{silences: map[string]*alertmanager.Silence{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/silences", func(w http.ResponseWriter, r *http.Request) {
+		am.mu.Lock()
+		defer am.mu.Unlock()
+
+		switch r.Method {
+		case http.MethodGet:
+			silences := []alertmanager.Silence{}
+			for _, s := range am.silences {
+				silences = append(silences, *s)
+			}
+			_ = json.NewEncoder(w).Encode(silences)
+
+		case http.MethodPost:
+			var s alertmanager.Silence
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if s.ID == "" {
+				am.nextID++
+				s.ID = strconv.Itoa(am.nextID)
+			} else if _, ok := am.silences[s.ID]; !ok {
+				http.Error(w, "silence not found", http.StatusNotFound)
+				return
+			}
+			s.Status = &alertmanager.SilenceStatus{State: alertmanager.SilenceActive}
+			am.silences[s.ID] = &s
+			am.posts++
+			_ = json.NewEncoder(w).Encode(map[string]string{"silenceID": s.ID})
+		}
+	})
+	mux.HandleFunc("/api/v2/silence/", func(w http.ResponseWriter, r *http.Request) {
+		am.mu.Lock()
+		defer am.mu.Unlock()
+
+		s, ok := am.silences[strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")]
+		if !ok || r.Method != http.MethodDelete {
+			http.Error(w, "silence not found", http.StatusNotFound)
+			return
+		}
+		s.Status.State = alertmanager.SilenceExpired
+		s.EndsAt = time.Now()
+	})
+	mux.HandleFunc("/api/v2/alerts", func(w http.ResponseWriter, r *http.Request) {
+		var alerts []alertmanager.Alert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		am.mu.Lock()
+		defer am.mu.Unlock()
+		am.alerts = append(am.alerts, alerts)
+	})
+
+	am.Server = httptest.NewServer(mux)
+	t.Cleanup(am.Close)
+
+	return am
+}
+
+// active returns active silences.
+func (am *fakeAlertmanager) active() []alertmanager.Silence {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	var res []alertmanager.Silence
+	for _, s := range am.silences {
+		if s.Active() {
+			res = append(res, *s)
+		}
+	}
+	return res
+}
+
+func (am *fakeAlertmanager) postCount() int {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return am.posts
+}
+
+// addSilence adds silence created by a user.
+func (am *fakeAlertmanager) addSilence(s alertmanager.Silence) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	s.Status = &alertmanager.SilenceStatus{State: alertmanager.SilenceActive}
+	am.silences[s.ID] = &s
+}
+
+func (am *fakeAlertmanager) silence(id string) alertmanager.Silence {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return *am.silences[id]
+}
+
+func (am *fakeAlertmanager) expire(id string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.silences[id].Status.State = alertmanager.SilenceExpired
+}
+
+// posted returns the last posted alerts.
+func (am *fakeAlertmanager) posted(t *testing.T) []alertmanager.Alert {
+	t.Helper()
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if len(am.alerts) == 0 {
+		t.Fatal("Expected alerts to be posted")
+	}
+	return am.alerts[len(am.alerts)-1]
+}
+
+func (am *fakeAlertmanager) alertPosts() int {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return len(am.alerts)
+}
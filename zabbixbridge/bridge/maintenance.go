@@ -0,0 +1,420 @@
+package bridge
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/alertmanager"
+	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
+	"github.com/pkg/errors"
+)
+
+const maintenanceSync = "maintenance"
+
+// SyncMaintenances creates Alertmanager silences for alerts of zal managed hosts in active Zabbix maintenance.
+// Silences end with the maintenance window and are expired when maintenance is changed or deleted.
+func (b *Bridge) SyncMaintenances() error {
+	hosts, err := b.hostIds()
+	if err != nil {
+		return err
+	}
+
+	silences, err := b.silences(maintenanceSync)
+	if err != nil {
+		return err
+	}
+
+	want := map[string]alertmanager.Silence{}
+	if len(hosts) != 0 {
+		if want, err = b.activeMaintenanceSilences(hosts); err != nil {
+			return err
+		}
+	}
+
+	keep := map[string]bool{}
+	for id, s := range want {
+		keep[id] = true
+
+		action := "created"
+		if existing, ok := silences[id]; ok {
+			if sameSilence(existing, s) {
+				continue
+			}
+			s.ID = existing.ID
+			s.StartsAt = existing.StartsAt
+			action = "updated"
+		}
+
+		if err := b.postSilence(maintenanceSync, action, &s); err != nil {
+			return err
+		}
+	}
+
+	return b.expireSilences(maintenanceSync, silences, keep)
+}
+
+// activeMaintenanceSilences returns silences of active maintenances by marker id.
+func (b *Bridge) activeMaintenanceSilences(hosts map[string]string) (map[string]alertmanager.Silence, error) {
+	maintenances, err := b.api.MaintenancesGet(zabbix.Params{
+		"selectHosts":       []string{"hostid", "host"},
+		"selectGroups":      []string{"groupid"},
+		"selectTimeperiods": "extend",
+		"selectTags":        "extend",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix maintenances")
+	}
+
+	now := b.now()
+	var active []zabbix.Maintenance
+	for _, m := range maintenances {
+		// maintenances mirrored from silences already have silences
+		if _, ok := parseMarker(m.Description, silenceSync); ok {
+			continue
+		}
+
+		if _, _, ok := maintenanceWindow(m, now, b.location); ok {
+			active = append(active, m)
+		}
+	}
+
+	want := map[string]alertmanager.Silence{}
+	if len(active) == 0 {
+		return want, nil
+	}
+
+	alertNames, err := b.hostAlertNames(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range active {
+		start, end, _ := maintenanceWindow(m, now, b.location)
+
+		inMaintenance, err := b.maintenanceHosts(m, hosts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, host := range inMaintenance {
+			names := alertNames[host]
+			if len(names) == 0 {
+				continue
+			}
+
+			hostMatchers, ok := b.hostMatchers(host)
+			if !ok {
+				continue
+			}
+
+			for i, matchers := range tagMatchers(m) {
+				id := fmt.Sprintf("%s:%s:%d", m.MaintenanceId, host, i)
+				silenceMatchers := append([]alertmanager.Matcher{alertNamesMatcher(names)}, hostMatchers...)
+				want[id] = alertmanager.Silence{
+					Matchers:  append(silenceMatchers, matchers...),
+					StartsAt:  start,
+					EndsAt:    end,
+					CreatedBy: CreatedBy,
+					Comment:   maintenanceComment(m, host, id),
+				}
+			}
+		}
+	}
+
+	return want, nil
+}
+
+// maintenanceHosts returns managed hosts in maintenance directly or through host groups.
+func (b *Bridge) maintenanceHosts(m zabbix.Maintenance, hosts map[string]string) ([]string, error) {
+	in := map[string]bool{}
+	for _, host := range m.Hosts {
+		if name, ok := hosts[host.HostId]; ok {
+			in[name] = true
+		}
+	}
+
+	if len(m.Groups) != 0 {
+		groupIds := make([]string, 0, len(m.Groups))
+		for _, group := range m.Groups {
+			groupIds = append(groupIds, group.GroupId)
+		}
+
+		hostIds := make([]string, 0, len(hosts))
+		for id := range hosts {
+			hostIds = append(hostIds, id)
+		}
+		sort.Strings(hostIds)
+
+		groupHosts, err := b.api.HostsGet(zabbix.Params{
+			"output":   []string{"hostid", "host"},
+			"groupids": groupIds,
+			"hostids":  hostIds,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting hosts of maintenance %s", m.MaintenanceId)
+		}
+
+		for _, host := range groupHosts {
+			in[host.Host] = true
+		}
+	}
+
+	res := make([]string, 0, len(in))
+	for host := range in {
+		res = append(res, host)
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
+
+// hostAlertNames returns alertnames of zal managed triggers by host.
+func (b *Bridge) hostAlertNames(hosts map[string]string) (map[string][]string, error) {
+	hostIds := make([]string, 0, len(hosts))
+	for id := range hosts {
+		hostIds = append(hostIds, id)
+	}
+	sort.Strings(hostIds)
+
+	triggers, err := b.managedTriggers(zabbix.Params{"hostids": hostIds})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	names := map[string][]string{}
+	for _, trigger := range triggers {
+		if seen[trigger.Host+"/"+trigger.AlertName] {
+			continue
+		}
+		seen[trigger.Host+"/"+trigger.AlertName] = true
+		names[trigger.Host] = append(names[trigger.Host], trigger.AlertName)
+	}
+
+	for _, n := range names {
+		sort.Strings(n)
+	}
+
+	return names, nil
+}
+
+// alertNamesMatcher matches any of the alertnames case insensitively.
+func alertNamesMatcher(names []string) alertmanager.Matcher {
+	if len(names) == 1 {
+		return alertNameMatcher(names[0])
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+
+	return alertmanager.Matcher{
+		Name:    "alertname",
+		Value:   "(?i)(" + strings.Join(quoted, "|") + ")",
+		IsRegex: true,
+	}
+}
+
+// tagMatchers converts maintenance tags to label matchers. Maintenance without tags silences all alerts.
+// With and/or evaluation values of the same tag are or-ed, so they are matched with a single regex.
+// Or evaluation can't be expressed by a single silence, so every tag gets its own silence.
+func tagMatchers(m zabbix.Maintenance) [][]alertmanager.Matcher {
+	if len(m.Tags) == 0 {
+		return [][]alertmanager.Matcher{nil}
+	}
+
+	if m.TagsEvalType == zabbix.TagsOr {
+		res := make([][]alertmanager.Matcher, len(m.Tags))
+		for i, tag := range m.Tags {
+			res[i] = []alertmanager.Matcher{tagMatcher(tag.Tag, []zabbix.MaintenanceTag{tag})}
+		}
+		return res
+	}
+
+	byName := map[string][]zabbix.MaintenanceTag{}
+	var names []string
+	for _, tag := range m.Tags {
+		if _, ok := byName[tag.Tag]; !ok {
+			names = append(names, tag.Tag)
+		}
+		byName[tag.Tag] = append(byName[tag.Tag], tag)
+	}
+
+	matchers := make([]alertmanager.Matcher, len(names))
+	for i, name := range names {
+		matchers[i] = tagMatcher(name, byName[name])
+	}
+
+	return [][]alertmanager.Matcher{matchers}
+}
+
+func tagMatcher(name string, tags []zabbix.MaintenanceTag) alertmanager.Matcher {
+	if len(tags) == 1 && tags[0].Operator == zabbix.TagEquals {
+		return alertmanager.Matcher{Name: name, Value: tags[0].Value}
+	}
+
+	values := make([]string, len(tags))
+	for i, tag := range tags {
+		values[i] = regexp.QuoteMeta(tag.Value)
+		if tag.Operator != zabbix.TagEquals {
+			values[i] = ".*" + values[i] + ".*"
+		}
+	}
+
+	return alertmanager.Matcher{
+		Name:    name,
+		Value:   strings.Join(values, "|"),
+		IsRegex: true,
+	}
+}
+
+func maintenanceComment(m zabbix.Maintenance, host, id string) string {
+	comment := fmt.Sprintf("Zabbix maintenance %s of host %s", m.Name, host)
+	if m.Description != "" {
+		comment += ": " + m.Description
+	}
+	return comment + " " + marker(maintenanceSync, id)
+}
+
+// sameSilence reports whether silence s needs no update to match want.
+func sameSilence(s, want alertmanager.Silence) bool {
+	return s.Comment == want.Comment && s.EndsAt.Equal(want.EndsAt) && sameMatchers(s.Matchers, want.Matchers)
+}
+
+func sameMatchers(matchers, want []alertmanager.Matcher) bool {
+	if len(matchers) != len(want) {
+		return false
+	}
+
+	for i, m := range matchers {
+		w := want[i]
+		if m.Name != w.Name || m.Value != w.Value || m.IsRegex != w.IsRegex || isEqual(m) != isEqual(w) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isEqual(m alertmanager.Matcher) bool {
+	return m.IsEqual == nil || *m.IsEqual
+}
+
+// maintenanceWindow returns the active window of the maintenance, which is the latest ending
+// window of its time periods, limited to the maintenance active since and till.
+func maintenanceWindow(m zabbix.Maintenance, now time.Time, loc *time.Location) (start, end time.Time, ok bool) {
+	since := time.Unix(m.ActiveSince, 0).In(loc)
+	till := time.Unix(m.ActiveTill, 0).In(loc)
+	now = now.In(loc)
+
+	if now.Before(since) || !now.Before(till) {
+		return start, end, false
+	}
+
+	for _, tp := range m.TimePeriods {
+		s, e, found := periodWindow(tp, since, now)
+		if !found {
+			continue
+		}
+
+		if s.Before(since) {
+			s = since
+		}
+		if e.After(till) {
+			e = till
+		}
+
+		if !ok || e.After(end) {
+			start, end, ok = s, e, true
+		}
+	}
+
+	return start, end, ok
+}
+
+// periodWindow returns the window of the time period which contains now. Recurring periods are
+// evaluated in the Zabbix server time zone and repeat relative to the maintenance active since.
+func periodWindow(tp zabbix.TimePeriod, since, now time.Time) (start, end time.Time, ok bool) {
+	period := time.Duration(tp.Period) * time.Second
+
+	if tp.TimePeriodType == zabbix.TimePeriodOneTime {
+		start = time.Unix(tp.StartDate, 0).In(now.Location())
+		end = start.Add(period)
+		return start, end, !now.Before(start) && now.Before(end)
+	}
+
+	// windows starting on previous days may still be active
+	days := int(period/(24*time.Hour)) + 1
+	for d := 0; d <= days; d++ {
+		day := time.Date(now.Year(), now.Month(), now.Day()-d, 0, 0, 0, 0, now.Location())
+		start = day.Add(time.Duration(tp.StartTime) * time.Second)
+		end = start.Add(period)
+
+		if now.Before(start) || !now.Before(end) {
+			continue
+		}
+
+		if periodStartsOn(tp, since, day) {
+			return start, end, true
+		}
+	}
+
+	return start, end, false
+}
+
+// periodStartsOn reports whether recurring time period starts on day.
+func periodStartsOn(tp zabbix.TimePeriod, since, day time.Time) bool {
+	every := tp.Every
+	if every < 1 {
+		every = 1
+	}
+
+	weekday := (int(day.Weekday()) + 6) % 7 // Monday is 0
+
+	switch tp.TimePeriodType {
+	case zabbix.TimePeriodDaily:
+		n := daysBetween(since, day)
+		return n >= 0 && n%every == 0
+
+	case zabbix.TimePeriodWeekly:
+		if tp.DayOfWeek&(1<<uint(weekday)) == 0 {
+			return false
+		}
+		sinceWeekday := (int(since.Weekday()) + 6) % 7
+		n := (daysBetween(since, day) + sinceWeekday) / 7
+		return daysBetween(since, day) >= 0 && n%every == 0
+
+	case zabbix.TimePeriodMonthly:
+		if tp.Month&(1<<uint(day.Month()-1)) == 0 {
+			return false
+		}
+
+		if tp.Day != 0 {
+			return day.Day() == tp.Day
+		}
+
+		if tp.DayOfWeek&(1<<uint(weekday)) == 0 {
+			return false
+		}
+
+		// every is the week of the month, 5 is the last week
+		if tp.Every >= 5 {
+			daysInMonth := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+			return day.Day()+7 > daysInMonth
+		}
+		return (day.Day()-1)/7+1 == every
+	}
+
+	return false
+}
+
+// daysBetween returns number of calendar days from a to b.
+func daysBetween(a, b time.Time) int {
+	ad := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	bd := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(bd.Sub(ad) / (24 * time.Hour))
+}
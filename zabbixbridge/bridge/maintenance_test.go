@@ -0,0 +1,216 @@
+package bridge_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/bridge"
+)
+
+func newMaintenanceBridge(t *testing.T, hostLabel string) (*fakeZabbix, *fakeAlertmanager, *bridge.Bridge) {
+	z := newFakeZabbix(t)
+	am := newFakeAlertmanager(t)
+
+	z.set("host.get", func(params interface{}) interface{} {
+		if params.(map[string]interface{})["groupids"] != nil {
+			return []map[string]interface{}{{"hostid": "11", "host": "apps"}}
+		}
+		return []map[string]interface{}{{"hostid": "10", "host": "infra"}, {"hostid": "11", "host": "apps"}}
+	})
+	z.set("trigger.get", []map[string]interface{}{
+		{"triggerid": "100", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0"},
+		{"triggerid": "101", "description": "DiskFull", "expression": "{infra:prometheus.diskfull.last()}<>0"},
+		{"triggerid": "102", "description": "AppDown", "expression": "{apps:prometheus.appdown.last()}<>0"},
+	})
+
+	b := bridge.New(bridge.Config{
+		ZabbixURL:           z.URL,
+		AlertmanagerURL:     am.URL,
+		KeyPrefix:           "prometheus",
+		Hosts:               []string{"infra", "apps"},
+		HostLabel:           hostLabel,
+		MaintenanceSilences: true,
+		Location:            time.UTC,
+	})
+
+	return z, am, b
+}
+
+func unix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func TestSyncMaintenancesPeriods(t *testing.T) {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	tomorrow := midnight.AddDate(0, 0, 1)
+	weekday := (int(now.Weekday()) + 6) % 7
+	otherWeekday := (weekday + 3) % 7
+
+	for _, tc := range []struct {
+		name       string
+		timeperiod map[string]interface{}
+		endsAt     time.Time
+	}{
+		{
+			name:       "one time",
+			timeperiod: map[string]interface{}{"timeperiod_type": "0", "start_date": unix(now.Add(-time.Hour)), "period": "7200"},
+			endsAt:     now.Add(time.Hour).Truncate(time.Second),
+		},
+		{
+			name:       "daily",
+			timeperiod: map[string]interface{}{"timeperiod_type": "2", "every": "1", "start_time": "0", "period": "86400"},
+			endsAt:     tomorrow,
+		},
+		{
+			name:       "weekly",
+			timeperiod: map[string]interface{}{"timeperiod_type": "3", "every": "1", "dayofweek": strconv.Itoa(1 << uint(weekday)), "start_time": "0", "period": "86400"},
+			endsAt:     tomorrow,
+		},
+		{
+			name:       "weekly other day",
+			timeperiod: map[string]interface{}{"timeperiod_type": "3", "every": "1", "dayofweek": strconv.Itoa(1 << uint(otherWeekday)), "start_time": "0", "period": "86400"},
+		},
+		{
+			name:       "monthly day",
+			timeperiod: map[string]interface{}{"timeperiod_type": "4", "month": "4095", "day": strconv.Itoa(now.Day()), "start_time": "0", "period": "86400"},
+			endsAt:     tomorrow,
+		},
+		{
+			name:       "monthly week day",
+			timeperiod: map[string]interface{}{"timeperiod_type": "4", "month": "4095", "every": strconv.Itoa((now.Day()-1)/7 + 1), "dayofweek": "127", "start_time": "0", "period": "86400"},
+			endsAt:     tomorrow,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			z, am, b := newMaintenanceBridge(t, "zabbix_host")
+
+			z.set("maintenance.get", []map[string]interface{}{{
+				"maintenanceid": "5",
+				"name":          "upgrade",
+				"active_since":  unix(midnight.AddDate(0, 0, -14)),
+				"active_till":   unix(midnight.AddDate(0, 0, 14)),
+				"timeperiods":   []map[string]interface{}{tc.timeperiod},
+				"hosts":         []map[string]interface{}{{"hostid": "10", "host": "infra"}},
+			}})
+
+			if err := b.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			silences := am.active()
+			if tc.endsAt.IsZero() {
+				if len(silences) != 0 {
+					t.Fatalf("Expected no silences, got %+v", silences)
+				}
+				return
+			}
+
+			if len(silences) != 1 {
+				t.Fatalf("Expected one silence, got %+v", silences)
+			}
+			s := silences[0]
+			if !s.EndsAt.Equal(tc.endsAt) {
+				t.Fatalf("Expected silence to end at %s, got %s", tc.endsAt, s.EndsAt)
+			}
+			if len(s.Matchers) != 2 || s.Matchers[0].Value != "(?i)(diskfull|highcpu)" ||
+				s.Matchers[1].Name != "zabbix_host" || s.Matchers[1].Value != "infra" || s.Matchers[1].IsRegex {
+				t.Fatalf("Unexpected matchers: %+v", s.Matchers)
+			}
+			if !strings.Contains(s.Comment, "upgrade") || !strings.Contains(s.Comment, "[zal:maintenance:5:infra:0]") {
+				t.Fatalf("Unexpected comment: %s", s.Comment)
+			}
+		})
+	}
+}
+
+func TestSyncMaintenancesTagsAndExpiry(t *testing.T) {
+	z, am, b := newMaintenanceBridge(t, "zabbix_host")
+
+	now := time.Now()
+	maintenance := map[string]interface{}{
+		"maintenanceid": "5",
+		"name":          "upgrade",
+		"active_since":  unix(now.Add(-time.Hour)),
+		"active_till":   unix(now.Add(time.Hour)),
+		"tags_evaltype": "0",
+		"timeperiods":   []map[string]interface{}{{"timeperiod_type": "0", "start_date": unix(now.Add(-time.Hour)), "period": "86400"}},
+		"tags": []map[string]interface{}{
+			{"tag": "team", "operator": "0", "value": "db"},
+			{"tag": "team", "operator": "2", "value": "web"},
+			{"tag": "env", "operator": "0", "value": "prod"},
+		},
+		"groups": []map[string]interface{}{{"groupid": "2"}},
+	}
+	z.set("maintenance.get", []map[string]interface{}{maintenance})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	silences := am.active()
+	if len(silences) != 1 {
+		t.Fatalf("Expected one silence of host in maintenance group, got %+v", silences)
+	}
+	s := silences[0]
+	if s.Matchers[0].Value != "(?i)appdown" || !s.EndsAt.Equal(now.Add(time.Hour).Truncate(time.Second)) {
+		t.Fatalf("Unexpected silence: %+v", s)
+	}
+	if len(s.Matchers) != 4 || s.Matchers[1].Name != "zabbix_host" || s.Matchers[1].Value != "apps" ||
+		s.Matchers[2].Name != "team" || s.Matchers[2].Value != "db|.*web.*" || !s.Matchers[2].IsRegex ||
+		s.Matchers[3].Name != "env" || s.Matchers[3].Value != "prod" || s.Matchers[3].IsRegex {
+		t.Fatalf("Unexpected tag matchers: %+v", s.Matchers)
+	}
+
+	// Or-ed tags get a silence each.
+	maintenance["tags_evaltype"] = "2"
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if silences := am.active(); len(silences) != 3 {
+		t.Fatalf("Expected a silence per tag, got %+v", silences)
+	}
+
+	// Unchanged maintenance isn't reposted.
+	posts := am.postCount()
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if am.postCount() != posts {
+		t.Fatalf("Expected silences not to be reposted")
+	}
+
+	// Deleted maintenance expires silences.
+	z.set("maintenance.get", []map[string]interface{}{})
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if silences := am.active(); len(silences) != 0 {
+		t.Fatalf("Expected silences to be expired, got %+v", silences)
+	}
+}
+
+func TestSyncMaintenancesWithoutHostLabel(t *testing.T) {
+	z, am, b := newMaintenanceBridge(t, "")
+
+	now := time.Now()
+	z.set("maintenance.get", []map[string]interface{}{{
+		"maintenanceid": "5",
+		"name":          "upgrade",
+		"active_since":  unix(now.Add(-time.Hour)),
+		"active_till":   unix(now.Add(time.Hour)),
+		"timeperiods":   []map[string]interface{}{{"timeperiod_type": "0", "start_date": unix(now.Add(-time.Hour)), "period": "7200"}},
+		"hosts":         []map[string]interface{}{{"hostid": "10", "host": "infra"}},
+	}})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Silences matching alertnames on all hosts need GlobalSilences.
+	if silences := am.active(); len(silences) != 0 {
+		t.Fatalf("Expected no silences, got %+v", silences)
+	}
+}
@@ -0,0 +1,238 @@
+package bridge
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/alertmanager"
+	"github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/provisioner"
+	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+const pullSync = "pull"
+
+var pulledAlertsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bridge_pulled_alerts_total",
+		Help: "Number of Zabbix problems posted to Alertmanager as alerts",
+	},
+	[]string{"status"},
+)
+
+// SyncProblems posts open Zabbix problems to Alertmanager as alerts. Problems of zal managed triggers
+// are skipped, as they originate from Alertmanager. Alerts are refreshed on every sync and resolved
+// once their problem is closed.
+func (b *Bridge) SyncProblems() error {
+	params := zabbix.Params{
+		"source":     0,
+		"object":     0,
+		"recent":     false,
+		"selectTags": "extend",
+	}
+
+	if len(b.hostGroups) != 0 {
+		groupIds, err := b.hostGroupIds()
+		if err != nil {
+			return err
+		}
+		if len(groupIds) == 0 {
+			return errors.Errorf("zabbix host groups %v not found", b.hostGroups)
+		}
+		params["groupids"] = groupIds
+	}
+
+	problems, err := b.api.ProblemsGet(params)
+	if err != nil {
+		return errors.Wrap(err, "error getting zabbix problems")
+	}
+
+	triggers, err := b.problemTriggers(problems)
+	if err != nil {
+		return err
+	}
+
+	now := b.now()
+	firing := map[string]alertmanager.Alert{}
+	for _, problem := range problems {
+		trigger, ok := triggers[problem.ObjectId]
+		if !ok {
+			continue
+		}
+
+		alert := b.problemAlert(problem, trigger)
+		alert.EndsAt = now.Add(b.resolveTimeout)
+		firing[problem.EventId] = alert
+	}
+
+	alerts := make([]alertmanager.Alert, 0, len(firing)+len(b.pulled))
+	for _, alert := range firing {
+		alerts = append(alerts, alert)
+	}
+
+	var resolved int
+	for id, alert := range b.pulled {
+		if _, ok := firing[id]; ok {
+			continue
+		}
+		alert.EndsAt = now
+		alerts = append(alerts, alert)
+		resolved++
+	}
+
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	if err := b.am.PostAlerts(alerts); err != nil {
+		// resolved alerts are kept to be resolved on the next sync
+		return errors.Wrap(err, "error posting alerts")
+	}
+
+	pulledAlertsTotal.WithLabelValues("firing").Add(float64(len(firing)))
+	pulledAlertsTotal.WithLabelValues("resolved").Add(float64(resolved))
+	log.Debugf("posted %d firing and %d resolved alerts of zabbix problems", len(firing), resolved)
+
+	b.pulled = firing
+
+	return nil
+}
+
+// hostGroupIds resolves host group names to Zabbix host group ids.
+func (b *Bridge) hostGroupIds() ([]string, error) {
+	groups, err := b.api.HostGroupsGet(zabbix.Params{
+		"output": []string{"groupid", "name"},
+		"filter": map[string][]string{"name": b.hostGroups},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix host groups")
+	}
+
+	ids := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.GroupId)
+	}
+
+	return ids, nil
+}
+
+// pulledTrigger is the trigger of a problem which isn't managed by zal.
+type pulledTrigger struct {
+	zabbix.Trigger
+	Host string
+}
+
+// problemTriggers returns triggers of the problems by trigger id, excluding zal managed triggers.
+func (b *Bridge) problemTriggers(problems zabbix.ProblemEvents) (map[string]pulledTrigger, error) {
+	if len(problems) == 0 {
+		return nil, nil
+	}
+
+	triggerIds := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		triggerIds = append(triggerIds, problem.ObjectId)
+	}
+
+	triggers, err := b.api.TriggersGet(zabbix.Params{
+		"triggerids":       triggerIds,
+		"output":           []string{"triggerid", "description", "expression", "priority"},
+		"expandExpression": true,
+		"selectHosts":      []string{"hostid", "host"},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix triggers")
+	}
+
+	res := make(map[string]pulledTrigger, len(triggers))
+	for _, trigger := range triggers {
+		if _, key, ok := triggerKey(trigger.Expression); ok {
+			if _, managed := b.alertName(key); managed {
+				continue
+			}
+		}
+
+		if len(trigger.Hosts) == 0 {
+			continue
+		}
+
+		res[trigger.TriggerId] = pulledTrigger{
+			Trigger: trigger,
+			Host:    trigger.Hosts[0].Host,
+		}
+	}
+
+	return res, nil
+}
+
+// problemAlert converts Zabbix problem to Alertmanager alert, event tags become labels.
+func (b *Bridge) problemAlert(problem zabbix.ProblemEvent, trigger pulledTrigger) alertmanager.Alert {
+	labels := map[string]string{
+		"alertname":           problem.Name,
+		"host":                trigger.Host,
+		"trigger":             trigger.Description,
+		"severity":            provisioner.GetPrometheusSeverity(problem.Severity),
+		zabbixsvc.SourceLabel: zabbixsvc.SourceZabbix,
+	}
+
+	tags := map[string][]string{}
+	for _, tag := range problem.Tags {
+		name := labelName(tag.Tag)
+		if _, reserved := labels[name]; reserved || name == "" {
+			continue
+		}
+		tags[name] = append(tags[name], tag.Value)
+	}
+	for name, values := range tags {
+		sort.Strings(values)
+		labels[name] = strings.Join(values, ",")
+	}
+
+	annotations := map[string]string{
+		"summary": problem.Name,
+		"eventid": problem.EventId,
+	}
+	if problem.Acknowledged == 1 {
+		annotations["acknowledged"] = "true"
+	}
+	if problem.Suppressed == 1 {
+		annotations["suppressed"] = "true"
+	}
+
+	return alertmanager.Alert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     time.Unix(problem.Clock, 0),
+		GeneratorURL: b.eventURL(trigger.TriggerId, problem.EventId),
+	}
+}
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// labelName converts Zabbix tag name to a valid Prometheus label name.
+func labelName(tag string) string {
+	name := invalidLabelChars.ReplaceAllString(tag, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// eventURL returns Zabbix frontend page of the event.
+func (b *Bridge) eventURL(triggerId, eventId string) string {
+	frontend := strings.TrimSuffix(b.zabbixURL, "api_jsonrpc.php")
+	if !strings.HasSuffix(frontend, "/") {
+		frontend += "/"
+	}
+
+	return frontend + "tr_events.php?" + url.Values{
+		"triggerid": {triggerId},
+		"eventid":   {eventId},
+	}.Encode()
+}
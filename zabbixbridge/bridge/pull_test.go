@@ -0,0 +1,103 @@
+package bridge_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/bridge"
+)
+
+func TestSyncProblems(t *testing.T) {
+	z := newFakeZabbix(t)
+	am := newFakeAlertmanager(t)
+
+	z.set("hostgroup.get", []map[string]interface{}{{"groupid": "2", "name": "Linux servers"}})
+	z.set("trigger.get", []map[string]interface{}{
+		{
+			"triggerid": "100", "description": "High CPU on {HOST.NAME}", "expression": "{db1:system.cpu.load.avg(5m)}>5",
+			"hosts": []map[string]interface{}{{"hostid": "10", "host": "db1"}},
+		},
+		{
+			"triggerid": "101", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0",
+			"hosts": []map[string]interface{}{{"hostid": "11", "host": "infra"}},
+		},
+	})
+	problems := []map[string]interface{}{
+		{
+			"eventid": "1000", "objectid": "100", "clock": "1600000000", "name": "High CPU on db1", "severity": "4", "acknowledged": "1",
+			"tags": []map[string]interface{}{
+				{"tag": "service", "value": "postgres"},
+				{"tag": "service", "value": "backup"},
+				{"tag": "app.name", "value": "db"},
+				{"tag": "host", "value": "ignored"},
+			},
+		},
+		{"eventid": "1001", "objectid": "101", "clock": "1600000000", "name": "HighCPU", "severity": "3"},
+	}
+	z.set("problem.get", problems)
+
+	b := bridge.New(bridge.Config{
+		ZabbixURL:       z.URL + "/zabbix/api_jsonrpc.php",
+		AlertmanagerURL: am.URL,
+		KeyPrefix:       "prometheus",
+		PullProblems:    true,
+		ResolveTimeout:  5 * time.Minute,
+		HostGroups:      []string{"Linux servers"},
+	})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := z.called("problem.get")
+	if groupIds := calls[0].(map[string]interface{})["groupids"].([]interface{}); len(groupIds) != 1 || groupIds[0] != "2" {
+		t.Fatalf("Expected problems of host groups, got %+v", calls[0])
+	}
+
+	posted := am.posted(t)
+	if len(posted) != 1 {
+		t.Fatalf("Expected one alert of the problem not managed by zal, got %+v", posted)
+	}
+	alert := posted[0]
+	for name, value := range map[string]string{
+		"alertname":  "High CPU on db1",
+		"host":       "db1",
+		"trigger":    "High CPU on {HOST.NAME}",
+		"severity":   "high",
+		"service":    "backup,postgres",
+		"app_name":   "db",
+		"zal_source": "zabbix",
+	} {
+		if alert.Labels[name] != value {
+			t.Fatalf("Expected label %s=%q, got %+v", name, value, alert.Labels)
+		}
+	}
+	if alert.Annotations["acknowledged"] != "true" || alert.Annotations["eventid"] != "1000" {
+		t.Fatalf("Unexpected annotations: %+v", alert.Annotations)
+	}
+	if !alert.StartsAt.Equal(time.Unix(1600000000, 0)) || time.Until(alert.EndsAt) < 4*time.Minute {
+		t.Fatalf("Unexpected alert times: %s - %s", alert.StartsAt, alert.EndsAt)
+	}
+	if alert.GeneratorURL != z.URL+"/zabbix/tr_events.php?eventid=1000&triggerid=100" {
+		t.Fatalf("Unexpected generator url: %s", alert.GeneratorURL)
+	}
+
+	// Closed problem resolves its alert.
+	z.set("problem.get", problems[1:])
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	posted = am.posted(t)
+	if len(posted) != 1 || posted[0].Labels["alertname"] != "High CPU on db1" || posted[0].EndsAt.After(time.Now()) {
+		t.Fatalf("Expected alert to be resolved, got %+v", posted)
+	}
+
+	// Resolved alerts are sent once.
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if n := am.alertPosts(); n != 2 {
+		t.Fatalf("Expected no more alert posts, got %d", n)
+	}
+}
@@ -0,0 +1,384 @@
+package bridge
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/alertmanager"
+	"github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/provisioner"
+	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	silenceSync = "silence"
+
+	// minMaintenancePeriod is the shortest maintenance period accepted by Zabbix.
+	minMaintenancePeriod = 5 * time.Minute
+)
+
+var maintenancesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bridge_maintenances_total",
+		Help: "Number of Zabbix maintenances changed by the bridge",
+	},
+	[]string{"action"},
+)
+
+// syncedSilence is the silence and maintenance end last synced, used to detect which side was changed.
+type syncedSilence struct {
+	maintenanceId   string
+	silenceEndsAt   int64
+	maintenanceTill int64
+}
+
+// SyncSilences creates Zabbix maintenances for Alertmanager silences of zal managed triggers.
+// Maintenances are updated when silences change and deleted when silences expire. Changed end
+// of the maintenance is copied to the silence and deleted maintenance expires the silence.
+func (b *Bridge) SyncSilences() error {
+	hosts, err := b.hostIds()
+	if err != nil {
+		return err
+	}
+
+	silences, err := b.am.Silences()
+	if err != nil {
+		return errors.Wrap(err, "error getting alertmanager silences")
+	}
+
+	maintenances, err := b.mirroredMaintenances()
+	if err != nil {
+		return err
+	}
+
+	var triggers map[string]managedTrigger
+	if len(hosts) != 0 {
+		hostIds := make([]string, 0, len(hosts))
+		for id := range hosts {
+			hostIds = append(hostIds, id)
+		}
+		sort.Strings(hostIds)
+
+		if triggers, err = b.managedTriggers(zabbix.Params{"hostids": hostIds}); err != nil {
+			return err
+		}
+	}
+
+	keep := map[string]bool{}
+	for _, s := range silences {
+		// silences created by zal are mirrored from Zabbix
+		if s.CreatedBy == CreatedBy || !s.Active() {
+			continue
+		}
+
+		want, ok := b.silenceMaintenance(s, hosts, triggers)
+		if !ok {
+			continue
+		}
+		keep[s.ID] = true
+
+		if err := b.syncSilence(s, want, maintenances[s.ID]); err != nil {
+			return err
+		}
+	}
+
+	var remove []string
+	for id, m := range maintenances {
+		if !keep[id] {
+			remove = append(remove, m.MaintenanceId)
+		}
+	}
+	for id := range b.synced {
+		if !keep[id] {
+			delete(b.synced, id)
+		}
+	}
+
+	if len(remove) == 0 {
+		return nil
+	}
+
+	sort.Strings(remove)
+	if err := b.api.MaintenancesDeleteByIds(remove); err != nil {
+		return errors.Wrapf(err, "error deleting maintenances %v", remove)
+	}
+	maintenancesTotal.WithLabelValues("deleted").Add(float64(len(remove)))
+	log.Infof("deleted maintenances %v of expired silences", remove)
+
+	return nil
+}
+
+// syncSilence syncs silence s and its maintenance m, want is the maintenance wanted by the silence.
+func (b *Bridge) syncSilence(s alertmanager.Silence, want zabbix.Maintenance, m *zabbix.Maintenance) error {
+	synced, wasSynced := b.synced[s.ID]
+	silenceChanged := !wasSynced || s.EndsAt.Unix() != synced.silenceEndsAt
+
+	switch {
+	case m == nil && wasSynced && !silenceChanged:
+		// maintenance was deleted in Zabbix
+		delete(b.synced, s.ID)
+		if err := b.am.ExpireSilence(s.ID); err != nil {
+			return errors.Wrapf(err, "error expiring silence %s of deleted maintenance", s.ID)
+		}
+		silencesTotal.WithLabelValues(silenceSync, "expired").Inc()
+		log.Infof("expired silence %s, its maintenance %s was deleted", s.ID, synced.maintenanceId)
+		return nil
+
+	case m != nil && wasSynced && !silenceChanged && m.ActiveTill != synced.maintenanceTill:
+		// maintenance end was changed in Zabbix
+		s.EndsAt = time.Unix(m.ActiveTill, 0)
+		if !s.EndsAt.After(b.now()) {
+			delete(b.synced, s.ID)
+			if err := b.am.ExpireSilence(s.ID); err != nil {
+				return errors.Wrapf(err, "error expiring silence %s of ended maintenance", s.ID)
+			}
+			silencesTotal.WithLabelValues(silenceSync, "expired").Inc()
+			return nil
+		}
+
+		if err := b.postSilence(silenceSync, "updated", &s); err != nil {
+			return err
+		}
+		b.synced[s.ID] = syncedSilence{maintenanceId: m.MaintenanceId, silenceEndsAt: m.ActiveTill, maintenanceTill: m.ActiveTill}
+		return nil
+	}
+
+	if m == nil {
+		ms := zabbix.Maintenances{want}
+		if err := b.api.MaintenancesCreate(ms); err != nil {
+			return errors.Wrapf(err, "error creating maintenance of silence %s", s.ID)
+		}
+		maintenancesTotal.WithLabelValues("created").Inc()
+		log.Infof("created maintenance %s of silence %s", ms[0].MaintenanceId, s.ID)
+
+		b.synced[s.ID] = syncedSilence{maintenanceId: ms[0].MaintenanceId, silenceEndsAt: s.EndsAt.Unix(), maintenanceTill: want.ActiveTill}
+		return nil
+	}
+
+	want.MaintenanceId = m.MaintenanceId
+	if !sameMaintenance(*m, want) {
+		if err := b.api.MaintenancesUpdate(zabbix.Maintenances{want}); err != nil {
+			return errors.Wrapf(err, "error updating maintenance %s of silence %s", m.MaintenanceId, s.ID)
+		}
+		maintenancesTotal.WithLabelValues("updated").Inc()
+		log.Infof("updated maintenance %s of silence %s", m.MaintenanceId, s.ID)
+	}
+
+	b.synced[s.ID] = syncedSilence{maintenanceId: m.MaintenanceId, silenceEndsAt: s.EndsAt.Unix(), maintenanceTill: want.ActiveTill}
+	return nil
+}
+
+// mirroredMaintenances returns maintenances created by the bridge by silence id.
+func (b *Bridge) mirroredMaintenances() (map[string]*zabbix.Maintenance, error) {
+	maintenances, err := b.api.MaintenancesGet(zabbix.Params{
+		"selectHosts":       []string{"hostid", "host"},
+		"selectTimeperiods": "extend",
+		"selectTags":        "extend",
+		"search":            map[string]string{"description": "[zal:" + silenceSync + ":"},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix maintenances")
+	}
+
+	res := map[string]*zabbix.Maintenance{}
+	for i, m := range maintenances {
+		if id, ok := parseMarker(m.Description, silenceSync); ok {
+			res[id] = &maintenances[i]
+		}
+	}
+
+	return res, nil
+}
+
+// silenceMaintenance returns the maintenance of silence s, if it matches zal managed triggers.
+// Triggers are matched by the alertname matcher, silences without it are ignored, and by the host
+// label matchers, if the host label is configured. Maintenance is
+// scoped with alertname tags unless all triggers of the hosts match. Other equal matchers become
+// tags when they match trigger tags, matchers of other labels are ignored, so the maintenance covers
+// all alerts of the matching triggers.
+func (b *Bridge) silenceMaintenance(s alertmanager.Silence, hosts map[string]string, triggers map[string]managedTrigger) (zabbix.Maintenance, bool) {
+	var nameMatchers, hostMatchers, otherMatchers []alertmanager.Matcher
+	for _, m := range s.Matchers {
+		switch {
+		case m.Name == "alertname":
+			nameMatchers = append(nameMatchers, m)
+		case b.hostLabel != "" && m.Name == b.hostLabel:
+			hostMatchers = append(hostMatchers, m)
+		default:
+			otherMatchers = append(otherMatchers, m)
+		}
+	}
+	if len(nameMatchers) == 0 {
+		return zabbix.Maintenance{}, false
+	}
+
+	hostIds := map[string]string{}
+	for id, name := range hosts {
+		hostIds[name] = id
+	}
+
+	matched := map[string]bool{}
+	names := map[string]bool{}
+	hostTriggers := map[string]int{}
+	hostMatched := map[string]int{}
+	tagNames := map[string]bool{}
+	allTagged := true
+
+	for _, trigger := range triggers {
+		hostTriggers[trigger.Host]++
+
+		name := trigger.AlertName
+		tagged := false
+		for _, tag := range trigger.Tags {
+			if tag.Tag == provisioner.AlertNameTag {
+				name = tag.Value
+				tagged = true
+			}
+		}
+
+		if !matchAll(nameMatchers, name, true) || !matchAll(hostMatchers, trigger.Host, false) {
+			continue
+		}
+
+		matched[trigger.Host] = true
+		hostMatched[trigger.Host]++
+		names[name] = true
+		allTagged = allTagged && tagged
+		for _, tag := range trigger.Tags {
+			tagNames[tag.Tag] = true
+		}
+	}
+
+	if len(matched) == 0 {
+		return zabbix.Maintenance{}, false
+	}
+
+	m := zabbix.Maintenance{
+		Name:            "zal silence " + s.ID,
+		Description:     silenceDescription(s),
+		MaintenanceType: zabbix.MaintenanceWithData,
+		ActiveSince:     s.StartsAt.Unix(),
+		ActiveTill:      s.EndsAt.Unix(),
+		TagsEvalType:    zabbix.TagsAndOr,
+	}
+
+	period := s.EndsAt.Sub(s.StartsAt)
+	if period < minMaintenancePeriod {
+		period = minMaintenancePeriod
+		m.ActiveTill = s.StartsAt.Add(period).Unix()
+	}
+	m.TimePeriods = []zabbix.TimePeriod{{
+		TimePeriodType: zabbix.TimePeriodOneTime,
+		StartDate:      m.ActiveSince,
+		Period:         int64(period / time.Second),
+	}}
+
+	wholeHosts := true
+	for host := range matched {
+		m.HostIds = append(m.HostIds, hostIds[host])
+		wholeHosts = wholeHosts && hostMatched[host] == hostTriggers[host]
+	}
+	sort.Strings(m.HostIds)
+
+	if !wholeHosts {
+		if allTagged {
+			for name := range names {
+				m.Tags = append(m.Tags, zabbix.MaintenanceTag{Tag: provisioner.AlertNameTag, Operator: zabbix.TagEquals, Value: name})
+			}
+		} else {
+			log.Warnf("triggers of silence %s have no %s tag, run zal prov to add it, whole hosts are put into maintenance", s.ID, provisioner.AlertNameTag)
+		}
+	}
+
+	for _, matcher := range otherMatchers {
+		if tagNames[matcher.Name] && !matcher.IsRegex && isEqual(matcher) {
+			m.Tags = append(m.Tags, zabbix.MaintenanceTag{Tag: matcher.Name, Operator: zabbix.TagEquals, Value: matcher.Value})
+		}
+	}
+	sortTags(m.Tags)
+
+	return m, true
+}
+
+// matchAll reports whether all matchers match value. Alertname is matched case insensitively,
+// because zal item keys are lower case.
+func matchAll(matchers []alertmanager.Matcher, value string, ignoreCase bool) bool {
+	for _, m := range matchers {
+		var match bool
+		switch {
+		case m.IsRegex:
+			expr := "^(?:" + m.Value + ")$"
+			if ignoreCase {
+				expr = "(?i)" + expr
+			}
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return false
+			}
+			match = re.MatchString(value)
+		case ignoreCase:
+			match = strings.EqualFold(m.Value, value)
+		default:
+			match = m.Value == value
+		}
+
+		if match != isEqual(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func silenceDescription(s alertmanager.Silence) string {
+	return fmt.Sprintf("Alertmanager silence by %s: %s %s", s.CreatedBy, s.Comment, marker(silenceSync, s.ID))
+}
+
+func sortTags(tags []zabbix.MaintenanceTag) {
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Tag != tags[j].Tag {
+			return tags[i].Tag < tags[j].Tag
+		}
+		return tags[i].Value < tags[j].Value
+	})
+}
+
+// sameMaintenance reports whether maintenance m needs no update to match want.
+func sameMaintenance(m, want zabbix.Maintenance) bool {
+	if m.Name != want.Name || m.Description != want.Description || m.ActiveSince != want.ActiveSince ||
+		m.ActiveTill != want.ActiveTill || m.TagsEvalType != want.TagsEvalType {
+		return false
+	}
+
+	if len(m.TimePeriods) != 1 || m.TimePeriods[0].TimePeriodType != zabbix.TimePeriodOneTime ||
+		m.TimePeriods[0].StartDate != want.TimePeriods[0].StartDate || m.TimePeriods[0].Period != want.TimePeriods[0].Period {
+		return false
+	}
+
+	hostIds := make([]string, 0, len(m.Hosts))
+	for _, host := range m.Hosts {
+		hostIds = append(hostIds, host.HostId)
+	}
+	sort.Strings(hostIds)
+	if strings.Join(hostIds, ",") != strings.Join(want.HostIds, ",") {
+		return false
+	}
+
+	tags := append([]zabbix.MaintenanceTag(nil), m.Tags...)
+	sortTags(tags)
+	if len(tags) != len(want.Tags) {
+		return false
+	}
+	for i := range tags {
+		if tags[i] != want.Tags[i] {
+			return false
+		}
+	}
+
+	return true
+}
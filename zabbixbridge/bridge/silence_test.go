@@ -0,0 +1,312 @@
+package bridge_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/alertmanager"
+	"github.com/devopyio/zabbix-alertmanager/zabbixbridge/bridge"
+)
+
+// fakeMaintenances keeps maintenances created through the fake Zabbix api.
+type fakeMaintenances struct {
+	nextID int
+	byID   map[string]map[string]interface{}
+}
+
+func newFakeMaintenances(z *fakeZabbix) *fakeMaintenances {
+	f := &fakeMaintenances{byID: map[string]map[string]interface{}{}}
+
+	// maintenance.get returns hosts instead of hostids
+	z.set("maintenance.get", func(params interface{}) interface{} {
+		res := []map[string]interface{}{}
+		for _, m := range f.byID {
+			got := map[string]interface{}{}
+			for k, v := range m {
+				got[k] = v
+			}
+
+			var hosts []map[string]interface{}
+			for _, id := range m["hostids"].([]interface{}) {
+				hosts = append(hosts, map[string]interface{}{"hostid": id})
+			}
+			got["hosts"] = hosts
+			res = append(res, zabbixStrings(got).(map[string]interface{}))
+		}
+		return res
+	})
+	z.set("maintenance.create", func(params interface{}) interface{} {
+		var ids []string
+		for _, p := range params.([]interface{}) {
+			f.nextID++
+			id := strconv.Itoa(f.nextID)
+			m := p.(map[string]interface{})
+			m["maintenanceid"] = id
+			f.byID[id] = m
+			ids = append(ids, id)
+		}
+		return map[string]interface{}{"maintenanceids": ids}
+	})
+	z.set("maintenance.update", func(params interface{}) interface{} {
+		var ids []string
+		for _, p := range params.([]interface{}) {
+			m := p.(map[string]interface{})
+			id := m["maintenanceid"].(string)
+			f.byID[id] = m
+			ids = append(ids, id)
+		}
+		return map[string]interface{}{"maintenanceids": ids}
+	})
+	z.set("maintenance.delete", func(params interface{}) interface{} {
+		var ids []string
+		for _, id := range params.([]interface{}) {
+			delete(f.byID, id.(string))
+			ids = append(ids, id.(string))
+		}
+		return map[string]interface{}{"maintenanceids": ids}
+	})
+
+	return f
+}
+
+// zabbixStrings formats numbers as strings, like Zabbix api does.
+func zabbixStrings(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[k] = zabbixStrings(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = zabbixStrings(e)
+		}
+		return res
+	}
+	return v
+}
+
+func (f *fakeMaintenances) only(t *testing.T) map[string]interface{} {
+	t.Helper()
+	if len(f.byID) != 1 {
+		t.Fatalf("Expected one maintenance, got %+v", f.byID)
+	}
+	for _, m := range f.byID {
+		return m
+	}
+	return nil
+}
+
+func TestSyncSilences(t *testing.T) {
+	z := newFakeZabbix(t)
+	am := newFakeAlertmanager(t)
+	maintenances := newFakeMaintenances(z)
+
+	z.set("host.get", []map[string]interface{}{{"hostid": "10", "host": "infra"}})
+	z.set("trigger.get", []map[string]interface{}{
+		{
+			"triggerid": "100", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0",
+			"tags": []map[string]interface{}{{"tag": "alertname", "value": "HighCPU"}, {"tag": "team", "value": "db"}},
+		},
+		{
+			"triggerid": "101", "description": "DiskFull", "expression": "{infra:prometheus.diskfull.last()}<>0",
+			"tags": []map[string]interface{}{{"tag": "alertname", "value": "DiskFull"}, {"tag": "team", "value": "db"}},
+		},
+	})
+
+	now := time.Now().Truncate(time.Second)
+	am.addSilence(alertmanager.Silence{
+		ID: "a",
+		Matchers: []alertmanager.Matcher{
+			{Name: "alertname", Value: "HighCPU"},
+			{Name: "team", Value: "db"},
+			{Name: "instance", Value: "node1"},
+		},
+		StartsAt:  now,
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "engineer",
+		Comment:   "upgrading node1",
+	})
+	am.addSilence(alertmanager.Silence{
+		ID:        "unknown",
+		Matchers:  []alertmanager.Matcher{{Name: "alertname", Value: "Unknown"}},
+		StartsAt:  now,
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "engineer",
+	})
+	am.addSilence(alertmanager.Silence{
+		ID:        "zal",
+		Matchers:  []alertmanager.Matcher{{Name: "alertname", Value: "HighCPU"}},
+		StartsAt:  now,
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: bridge.CreatedBy,
+	})
+
+	b := bridge.New(bridge.Config{
+		ZabbixURL:           z.URL,
+		AlertmanagerURL:     am.URL,
+		KeyPrefix:           "prometheus",
+		Hosts:               []string{"infra"},
+		SilenceMaintenances: true,
+	})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := maintenances.only(t)
+	if m["name"] != "zal silence a" || m["active_since"] != float64(now.Unix()) || m["active_till"] != float64(now.Add(time.Hour).Unix()) {
+		t.Fatalf("Unexpected maintenance: %+v", m)
+	}
+	if hostIds := m["hostids"].([]interface{}); len(hostIds) != 1 || hostIds[0] != "10" {
+		t.Fatalf("Unexpected maintenance hosts: %+v", hostIds)
+	}
+	tags := m["tags"].([]interface{})
+	if len(tags) != 2 ||
+		tags[0].(map[string]interface{})["tag"] != "alertname" || tags[0].(map[string]interface{})["value"] != "HighCPU" ||
+		tags[1].(map[string]interface{})["tag"] != "team" || tags[1].(map[string]interface{})["value"] != "db" {
+		t.Fatalf("Unexpected maintenance tags: %+v", tags)
+	}
+
+	// Unchanged silence doesn't update the maintenance.
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if calls := z.called("maintenance.update"); len(calls) != 0 {
+		t.Fatalf("Expected no updates, got %+v", calls)
+	}
+
+	// Silence edited in Alertmanager updates the maintenance.
+	s := am.silence("a")
+	s.EndsAt = now.Add(2 * time.Hour)
+	s.Matchers = []alertmanager.Matcher{{Name: "alertname", Value: "HighCPU|DiskFull", IsRegex: true}}
+	am.addSilence(s)
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	m = maintenances.only(t)
+	if m["active_till"] != float64(now.Add(2*time.Hour).Unix()) || m["tags"] != nil {
+		t.Fatalf("Expected maintenance of the whole host until the new end, got %+v", m)
+	}
+
+	// Maintenance edited in Zabbix updates the silence.
+	m["active_till"] = strconv.FormatInt(now.Add(3*time.Hour).Unix(), 10)
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if s := am.silence("a"); !s.EndsAt.Equal(now.Add(3 * time.Hour)) {
+		t.Fatalf("Expected silence to end with the maintenance, got %s", s.EndsAt)
+	}
+
+	// Maintenance deleted in Zabbix expires the silence.
+	maintenances.byID = map[string]map[string]interface{}{}
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if s := am.silence("a"); s.Active() {
+		t.Fatalf("Expected silence to be expired, got %+v", s)
+	}
+}
+
+func TestSyncSilencesExpired(t *testing.T) {
+	z := newFakeZabbix(t)
+	am := newFakeAlertmanager(t)
+	maintenances := newFakeMaintenances(z)
+
+	z.set("host.get", []map[string]interface{}{{"hostid": "10", "host": "infra"}})
+	z.set("trigger.get", []map[string]interface{}{
+		{"triggerid": "100", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0"},
+	})
+
+	now := time.Now()
+	am.addSilence(alertmanager.Silence{
+		ID:        "a",
+		Matchers:  []alertmanager.Matcher{{Name: "alertname", Value: "highcpu"}},
+		StartsAt:  now,
+		EndsAt:    now.Add(time.Minute),
+		CreatedBy: "engineer",
+	})
+
+	b := bridge.New(bridge.Config{
+		ZabbixURL:           z.URL,
+		AlertmanagerURL:     am.URL,
+		KeyPrefix:           "prometheus",
+		Hosts:               []string{"infra"},
+		SilenceMaintenances: true,
+	})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := maintenances.only(t)
+	if m["active_till"] != float64(now.Add(5*time.Minute).Unix()) {
+		t.Fatalf("Expected the shortest maintenance, got %+v", m)
+	}
+
+	// Expired silence deletes the maintenance.
+	am.expire("a")
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(maintenances.byID) != 0 {
+		t.Fatalf("Expected maintenance to be deleted, got %+v", maintenances.byID)
+	}
+}
+
+func TestSyncSilencesHostLabel(t *testing.T) {
+	z := newFakeZabbix(t)
+	am := newFakeAlertmanager(t)
+	maintenances := newFakeMaintenances(z)
+
+	z.set("host.get", []map[string]interface{}{{"hostid": "10", "host": "infra"}, {"hostid": "11", "host": "apps"}})
+	z.set("trigger.get", []map[string]interface{}{
+		{"triggerid": "100", "description": "HighCPU", "expression": "{infra:prometheus.highcpu.last()}<>0"},
+		{"triggerid": "101", "description": "HighCPU", "expression": "{apps:prometheus.highcpu.last()}<>0"},
+	})
+
+	now := time.Now().Truncate(time.Second)
+	am.addSilence(alertmanager.Silence{
+		ID:        "a",
+		Matchers:  []alertmanager.Matcher{{Name: "alertname", Value: "HighCPU"}, {Name: "zabbix_host", Value: "infra"}},
+		StartsAt:  now,
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "engineer",
+	})
+
+	b := bridge.New(bridge.Config{
+		ZabbixURL:           z.URL,
+		AlertmanagerURL:     am.URL,
+		KeyPrefix:           "prometheus",
+		Hosts:               []string{"infra", "apps"},
+		HostLabel:           "zabbix_host",
+		SilenceMaintenances: true,
+	})
+
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	m := maintenances.only(t)
+	if hostIds := m["hostids"].([]interface{}); len(hostIds) != 1 || hostIds[0] != "10" {
+		t.Fatalf("Expected maintenance of the silenced host only, got %+v", hostIds)
+	}
+
+	// Negated regex host matcher puts the other hosts into maintenance.
+	notEqual := false
+	s := am.silence("a")
+	s.Matchers = []alertmanager.Matcher{{Name: "alertname", Value: "HighCPU"}, {Name: "zabbix_host", Value: "inf.*", IsRegex: true, IsEqual: &notEqual}}
+	am.addSilence(s)
+	if err := b.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	m = maintenances.only(t)
+	if hostIds := m["hostids"].([]interface{}); len(hostIds) != 1 || hostIds[0] != "11" {
+		t.Fatalf("Expected maintenance of the not silenced host, got %+v", hostIds)
+	}
+}
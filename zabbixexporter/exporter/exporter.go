@@ -0,0 +1,337 @@
+package exporter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/provisioner"
+	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	refreshErrorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "zabbix_exporter_refresh_errors_total",
+			Help: "Number of failed refreshes of Zabbix state",
+		},
+	)
+
+	triggerValueDesc = prometheus.NewDesc(
+		"zabbix_trigger_value",
+		"Zabbix trigger value, 1 is problem and 0 is ok",
+		[]string{"host", "trigger", "triggerid", "severity"}, nil,
+	)
+
+	triggerLastChangeDesc = prometheus.NewDesc(
+		"zabbix_trigger_last_change_timestamp_seconds",
+		"Time of the last Zabbix trigger value change",
+		[]string{"host", "trigger", "triggerid"}, nil,
+	)
+
+	problemsDesc = prometheus.NewDesc(
+		"zabbix_problems",
+		"Number of open Zabbix problems",
+		[]string{"severity", "acknowledged"}, nil,
+	)
+
+	itemLastValueDesc = prometheus.NewDesc(
+		"zabbix_item_last_value",
+		"Last value of zal managed Zabbix trapper item",
+		[]string{"host", "key"}, nil,
+	)
+
+	itemLastClockDesc = prometheus.NewDesc(
+		"zabbix_item_last_clock_timestamp_seconds",
+		"Time of the last value of zal managed Zabbix trapper item",
+		[]string{"host", "key"}, nil,
+	)
+
+	lastRefreshDesc = prometheus.NewDesc(
+		"zabbix_exporter_last_refresh_timestamp_seconds",
+		"Time of the last successful refresh of Zabbix state",
+		nil, nil,
+	)
+)
+
+// Config configures the exporter of Zabbix state.
+type Config struct {
+	ZabbixURL string
+	User      string
+	Password  string
+	// Transport is used for Zabbix api calls, nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+	KeyPrefix string
+	// Hosts limits exported state to the Zabbix hosts, empty exports all monitored hosts.
+	Hosts []string
+}
+
+// Exporter is a Prometheus collector of Zabbix trigger, problem and item state.
+// Metrics are cached between refreshes, so scrapes don't query Zabbix.
+type Exporter struct {
+	api       *zabbix.API
+	user      string
+	password  string
+	keyPrefix string
+	hosts     []string
+
+	mu          sync.RWMutex
+	metrics     []prometheus.Metric
+	lastRefresh time.Time
+}
+
+// New creates the exporter, Zabbix api login happens on the first refresh.
+func New(cfg Config) *Exporter {
+	transport := cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	api := zabbix.NewAPI(cfg.ZabbixURL)
+	api.SetClient(&http.Client{
+		Transport: transport,
+	})
+
+	return &Exporter{
+		api:       api,
+		user:      cfg.User,
+		password:  cfg.Password,
+		keyPrefix: strings.ToLower(cfg.KeyPrefix),
+		hosts:     cfg.Hosts,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- triggerValueDesc
+	ch <- triggerLastChangeDesc
+	ch <- problemsDesc
+	ch <- itemLastValueDesc
+	ch <- itemLastClockDesc
+	ch <- lastRefreshDesc
+}
+
+// Collect implements prometheus.Collector, it sends metrics of the last successful refresh.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for _, m := range e.metrics {
+		ch <- m
+	}
+
+	var lastRefresh float64
+	if !e.lastRefresh.IsZero() {
+		lastRefresh = float64(e.lastRefresh.Unix())
+	}
+	ch <- prometheus.MustNewConstMetric(lastRefreshDesc, prometheus.GaugeValue, lastRefresh)
+}
+
+// Run refreshes Zabbix state every interval until stop is closed.
+func (e *Exporter) Run(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := e.Refresh(); err != nil {
+			log.Error(err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Refresh queries Zabbix and replaces cached metrics. Metrics of the previous refresh are kept on error.
+func (e *Exporter) Refresh() error {
+	metrics, err := e.collect()
+	if err != nil {
+		refreshErrorsTotal.Inc()
+
+		// Zabbix api errors include expired sessions, login again on the next refresh.
+		if _, ok := errors.Cause(err).(*zabbix.Error); ok {
+			e.api.Auth = ""
+		}
+
+		return errors.Wrap(err, "error refreshing zabbix state")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metrics = metrics
+	e.lastRefresh = time.Now()
+
+	return nil
+}
+
+func (e *Exporter) collect() ([]prometheus.Metric, error) {
+	if e.api.Auth == "" {
+		if _, err := e.api.Login(e.user, e.password); err != nil {
+			return nil, errors.Wrap(err, "error while login to zabbix api")
+		}
+	}
+
+	hosts, err := e.hostIds()
+	if err != nil {
+		return nil, err
+	}
+
+	hostIds := make([]string, 0, len(hosts))
+	for id := range hosts {
+		hostIds = append(hostIds, id)
+	}
+
+	if len(hostIds) == 0 {
+		return problemMetrics(nil), nil
+	}
+
+	var metrics []prometheus.Metric
+	triggers, err := e.triggerMetrics(hostIds)
+	if err != nil {
+		return nil, err
+	}
+	metrics = append(metrics, triggers...)
+
+	problems, err := e.api.ProblemsGet(zabbix.Params{
+		"output":  []string{"eventid", "severity", "acknowledged"},
+		"hostids": hostIds,
+		"source":  0,
+		"object":  0,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix problems")
+	}
+	metrics = append(metrics, problemMetrics(problems)...)
+
+	items, err := e.itemMetrics(hosts)
+	if err != nil {
+		return nil, err
+	}
+	metrics = append(metrics, items...)
+
+	return metrics, nil
+}
+
+// hostIds returns monitored hosts by host id.
+func (e *Exporter) hostIds() (map[string]string, error) {
+	params := zabbix.Params{
+		"output":          []string{"hostid", "host"},
+		"monitored_hosts": true,
+	}
+	if len(e.hosts) != 0 {
+		params["filter"] = map[string][]string{"host": e.hosts}
+	}
+
+	hosts, err := e.api.HostsGet(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix hosts")
+	}
+
+	ids := make(map[string]string, len(hosts))
+	for _, host := range hosts {
+		ids[host.HostId] = host.Host
+	}
+
+	return ids, nil
+}
+
+func (e *Exporter) triggerMetrics(hostIds []string) ([]prometheus.Metric, error) {
+	triggers, err := e.api.TriggersGet(zabbix.Params{
+		"output":      []string{"triggerid", "description", "priority", "value", "lastchange"},
+		"hostids":     hostIds,
+		"monitored":   true,
+		"selectHosts": []string{"hostid", "host"},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix triggers")
+	}
+
+	var metrics []prometheus.Metric
+	for _, trigger := range triggers {
+		severity := provisioner.GetPrometheusSeverity(trigger.Priority)
+		for _, host := range trigger.Hosts {
+			metrics = append(metrics,
+				prometheus.MustNewConstMetric(triggerValueDesc, prometheus.GaugeValue, float64(trigger.Value),
+					host.Host, trigger.Description, trigger.TriggerId, severity),
+				prometheus.MustNewConstMetric(triggerLastChangeDesc, prometheus.GaugeValue, float64(trigger.LastChange),
+					host.Host, trigger.Description, trigger.TriggerId),
+			)
+		}
+	}
+
+	return metrics, nil
+}
+
+// problemMetrics counts problems by severity and acknowledgement, all combinations are exported.
+func problemMetrics(problems zabbix.ProblemEvents) []prometheus.Metric {
+	type bucket struct {
+		severity     zabbix.PriorityType
+		acknowledged bool
+	}
+
+	counts := map[bucket]int{}
+	for _, problem := range problems {
+		counts[bucket{problem.Severity, problem.Acknowledged == 1}]++
+	}
+
+	var metrics []prometheus.Metric
+	for severity := zabbix.NotClassified; severity <= zabbix.Critical; severity++ {
+		for _, acknowledged := range []bool{false, true} {
+			metrics = append(metrics, prometheus.MustNewConstMetric(problemsDesc, prometheus.GaugeValue,
+				float64(counts[bucket{severity, acknowledged}]),
+				provisioner.GetPrometheusSeverity(severity), strconv.FormatBool(acknowledged)))
+		}
+	}
+
+	return metrics
+}
+
+// itemMetrics exports last values of zal managed trapper items. Items without numeric values only
+// export the last clock.
+func (e *Exporter) itemMetrics(hosts map[string]string) ([]prometheus.Metric, error) {
+	hostIds := make([]string, 0, len(hosts))
+	for id := range hosts {
+		hostIds = append(hostIds, id)
+	}
+
+	items, err := e.api.ItemsGet(zabbix.Params{
+		"output":      []string{"itemid", "hostid", "key_", "lastvalue", "lastclock"},
+		"hostids":     hostIds,
+		"filter":      map[string]interface{}{"type": zabbix.ZabbixTrapper},
+		"search":      map[string]string{"key_": e.keyPrefix + "."},
+		"startSearch": true,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting zabbix items")
+	}
+
+	var metrics []prometheus.Metric
+	for _, item := range items {
+		host := hosts[item.HostId]
+
+		// items without values have lastclock 0
+		if item.LastClock == 0 {
+			continue
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(itemLastClockDesc, prometheus.GaugeValue,
+			float64(item.LastClock), host, item.Key))
+
+		value, err := strconv.ParseFloat(item.LastValue, 64)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(itemLastValueDesc, prometheus.GaugeValue,
+			value, host, item.Key))
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,130 @@
+package exporter_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixexporter/exporter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeZabbix serves Zabbix json rpc api, results are returned by method.
+func fakeZabbix(t *testing.T, results map[string]interface{}) (*httptest.Server, *sync.Map) {
+	calls := &sync.Map{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+			ID     int                    `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid zabbix request: %v", err)
+			return
+		}
+		calls.Store(req.Method, req.Params)
+
+		result := results[req.Method]
+		if req.Method == "user.login" {
+			result = "token"
+		}
+
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result}); err != nil {
+			t.Errorf("can't encode zabbix response: %v", err)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s, calls
+}
+
+func TestExporter(t *testing.T) {
+	z, calls := fakeZabbix(t, map[string]interface{}{
+		"host.get": []map[string]interface{}{{"hostid": "10", "host": "infra"}},
+		"trigger.get": []map[string]interface{}{
+			{
+				"triggerid": "100", "description": "HighCPU", "priority": "4", "value": "1", "lastchange": "1600000000",
+				"hosts": []map[string]interface{}{{"hostid": "10", "host": "infra"}},
+			},
+			{
+				"triggerid": "101", "description": "DiskFull", "priority": "2", "value": "0", "lastchange": "1500000000",
+				"hosts": []map[string]interface{}{{"hostid": "10", "host": "infra"}},
+			},
+		},
+		"problem.get": []map[string]interface{}{
+			{"eventid": "1", "severity": "4", "acknowledged": "1"},
+			{"eventid": "2", "severity": "4", "acknowledged": "0"},
+			{"eventid": "3", "severity": "4", "acknowledged": "0"},
+		},
+		"item.get": []map[string]interface{}{
+			{"itemid": "1", "hostid": "10", "key_": "prometheus.highcpu", "lastvalue": "1", "lastclock": "1600000000"},
+			{"itemid": "2", "hostid": "10", "key_": "prometheus.diskfull", "lastvalue": "", "lastclock": "0"},
+		},
+	})
+
+	e := exporter.New(exporter.Config{
+		ZabbixURL: z.URL,
+		KeyPrefix: "prometheus",
+		Hosts:     []string{"infra"},
+	})
+
+	if err := e.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP zabbix_trigger_value Zabbix trigger value, 1 is problem and 0 is ok
+# TYPE zabbix_trigger_value gauge
+zabbix_trigger_value{host="infra",severity="high",trigger="HighCPU",triggerid="100"} 1
+zabbix_trigger_value{host="infra",severity="warning",trigger="DiskFull",triggerid="101"} 0
+# HELP zabbix_trigger_last_change_timestamp_seconds Time of the last Zabbix trigger value change
+# TYPE zabbix_trigger_last_change_timestamp_seconds gauge
+zabbix_trigger_last_change_timestamp_seconds{host="infra",trigger="HighCPU",triggerid="100"} 1.6e+09
+zabbix_trigger_last_change_timestamp_seconds{host="infra",trigger="DiskFull",triggerid="101"} 1.5e+09
+# HELP zabbix_item_last_value Last value of zal managed Zabbix trapper item
+# TYPE zabbix_item_last_value gauge
+zabbix_item_last_value{host="infra",key="prometheus.highcpu"} 1
+# HELP zabbix_item_last_clock_timestamp_seconds Time of the last value of zal managed Zabbix trapper item
+# TYPE zabbix_item_last_clock_timestamp_seconds gauge
+zabbix_item_last_clock_timestamp_seconds{host="infra",key="prometheus.highcpu"} 1.6e+09
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected),
+		"zabbix_trigger_value", "zabbix_trigger_last_change_timestamp_seconds",
+		"zabbix_item_last_value", "zabbix_item_last_clock_timestamp_seconds"); err != nil {
+		t.Fatal(err)
+	}
+
+	// problems are counted for every severity and acknowledgement
+	if n := testutil.CollectAndCount(e, "zabbix_problems"); n != 12 {
+		t.Fatalf("Expected 12 problem series, got %d", n)
+	}
+	expected = `
+# HELP zabbix_problems Number of open Zabbix problems
+# TYPE zabbix_problems gauge
+zabbix_problems{acknowledged="false",severity="average"} 0
+zabbix_problems{acknowledged="false",severity="critical"} 0
+zabbix_problems{acknowledged="false",severity="high"} 2
+zabbix_problems{acknowledged="false",severity="information"} 0
+zabbix_problems{acknowledged="false",severity="not_classified"} 0
+zabbix_problems{acknowledged="false",severity="warning"} 0
+zabbix_problems{acknowledged="true",severity="average"} 0
+zabbix_problems{acknowledged="true",severity="critical"} 0
+zabbix_problems{acknowledged="true",severity="high"} 1
+zabbix_problems{acknowledged="true",severity="information"} 0
+zabbix_problems{acknowledged="true",severity="not_classified"} 0
+zabbix_problems{acknowledged="true",severity="warning"} 0
+`
+	if err := testutil.CollectAndCompare(e, strings.NewReader(expected), "zabbix_problems"); err != nil {
+		t.Fatal(err)
+	}
+
+	params, _ := calls.Load("item.get")
+	search := params.(map[string]interface{})["search"].(map[string]interface{})
+	if search["key_"] != "prometheus." {
+		t.Fatalf("Expected zal managed items to be requested, got %+v", params)
+	}
+}
@@ -0,0 +1,102 @@
+package provisioner_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/itemkey"
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
+	"github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/provisioner"
+	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
+)
+
+// loadRules loads rules of the dir into a host of the encoding, Zabbix only answers the login.
+func loadRules(t *testing.T, dir, encoding string, samples itemvalue.SampleConfig) *provisioner.CustomHost {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "result": "token"})
+	}))
+	defer s.Close()
+
+	host := provisioner.HostConfig{Name: "infra", HostGroups: []string{"prometheus"}, HostAlertsDir: dir, ItemDefaultTrends: "90d", ValueEncoding: encoding}
+
+	prov, err := provisioner.New("", "prometheus", itemkey.Config{}, samples, s.URL, "user", "password", []provisioner.HostConfig{host}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prov.CustomZabbix = &provisioner.CustomZabbix{
+		Hosts:      map[string]*provisioner.CustomHost{},
+		HostGroups: map[string]*provisioner.CustomHostGroup{},
+	}
+	if err := prov.LoadRulesFromPrometheus(host); err != nil {
+		t.Fatal(err)
+	}
+
+	return prov.Hosts["infra"]
+}
+
+func TestLoadRulesValueEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		encoding   string
+		valueType  zabbix.ValueType
+		trends     string
+		expression string
+	}{
+		{"", zabbix.Unsigned, "90d", "{infra:prometheus.instance1.last()}<>0"},
+		{itemvalue.String, zabbix.Character, "0", "{infra:prometheus.instance1.str(PROBLEM)}=1"},
+		{itemvalue.JSON, zabbix.Text, "0", `{infra:prometheus.instance1.str("{\"status\":\"firing\"")}=1`},
+	} {
+		host := loadRules(t, rulesOKpath, tc.encoding, itemvalue.SampleConfig{})
+
+		item, ok := host.Items["prometheus.instance1"]
+		if !ok {
+			t.Fatalf("encoding %q: item prometheus.instance1 not found", tc.encoding)
+		}
+		if item.ValueType != tc.valueType || item.Trends != tc.trends {
+			t.Errorf("encoding %q: expected value type %v and trends %s, got %v and %s", tc.encoding, tc.valueType, tc.trends, item.ValueType, item.Trends)
+		}
+
+		if _, ok := host.Triggers[tc.expression]; !ok {
+			t.Errorf("encoding %q: trigger %s not found", tc.encoding, tc.expression)
+		}
+	}
+}
+
+func TestLoadRulesSeverityEncoding(t *testing.T) {
+	host := loadRules(t, rulesOKpath, itemvalue.Severity, itemvalue.SampleConfig{})
+
+	for p := zabbix.Information; p <= zabbix.Critical; p++ {
+		trigger, ok := host.Triggers[fmt.Sprintf("{infra:prometheus.instance1.last()}=%d", p)]
+		if !ok {
+			t.Fatalf("trigger of priority %d not found", p)
+		}
+		if trigger.Priority != p {
+			t.Errorf("expected priority %d, got %d", p, trigger.Priority)
+		}
+		if expected := "Instance1 (" + provisioner.GetPrometheusSeverity(p) + ")"; trigger.Description != expected {
+			t.Errorf("expected description %s, got %s", expected, trigger.Description)
+		}
+	}
+}
+
+func TestLoadRulesSamples(t *testing.T) {
+	host := loadRules(t, "./testdata/samples/", itemvalue.Severity, itemvalue.SampleConfig{Annotation: "value"})
+
+	sample, ok := host.Items["prometheus.diskfull.value"]
+	if !ok {
+		t.Fatal("sample item prometheus.diskfull.value not found")
+	}
+	if sample.ValueType != zabbix.Float || sample.Trends != "90d" {
+		t.Errorf("expected float sample item with trends, got %v and %s", sample.ValueType, sample.Trends)
+	}
+
+	if _, ok := host.Items["prometheus.instancedown.value"]; ok {
+		t.Error("expected no sample item of rule without the annotation")
+	}
+	if len(host.Items) != 3 {
+		t.Errorf("expected 3 items, got %d", len(host.Items))
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/devopyio/zabbix-alertmanager/itemkey"
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
 	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -24,18 +26,29 @@ type HostConfig struct {
 	ItemDefaultTrapperHosts string            `yaml:"itemDefaultTrapperHosts"`
 	HostAlertsDir           string            `yaml:"alertsDir"`
 	TriggerTags             map[string]string `yaml:"triggerTags"`
+	// ValueEncoding is the encoding of values zal send sends to items of the host, numeric if empty.
+	ValueEncoding string `yaml:"valueEncoding"`
 }
 
+// AlertNameTag is the trigger tag holding the name of the Prometheus alerting rule.
+const AlertNameTag = "alertname"
+
 type Provisioner struct {
 	api           *zabbix.API
 	keyPrefix     string
+	keys          itemkey.Config
+	samples       itemvalue.SampleConfig
 	hosts         []HostConfig
 	prometheusUrl string
 	*CustomZabbix
 }
 
-func New(prometheusUrl, keyPrefix, url, user, password string, hosts []HostConfig) (*Provisioner, error) {
-	transport := http.DefaultTransport
+// New logs in to Zabbix api. Item keys are named by keys, float items are created for rules declaring
+// samples. Nil transport uses http.DefaultTransport.
+func New(prometheusUrl, keyPrefix string, keys itemkey.Config, samples itemvalue.SampleConfig, url, user, password string, hosts []HostConfig, transport http.RoundTripper) (*Provisioner, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
 
 	api := zabbix.NewAPI(url)
 	api.SetClient(&http.Client{
@@ -50,6 +63,8 @@ func New(prometheusUrl, keyPrefix, url, user, password string, hosts []HostConfi
 	return &Provisioner{
 		api:           api,
 		keyPrefix:     keyPrefix,
+		keys:          keys,
+		samples:       samples,
 		hosts:         hosts,
 		prometheusUrl: prometheusUrl,
 	}, nil
@@ -146,11 +161,14 @@ func (p *Provisioner) LoadRulesFromPrometheus(hostConfig HostConfig) error {
 
 	// Parse Prometheus rules and create corresponding items/triggers and applications for this host
 	for _, rule := range rules {
-		key := fmt.Sprintf("%s.%s", strings.ToLower(p.keyPrefix), strings.ToLower(rule.Name))
+		key := p.keys.Key(strings.ToLower(p.keyPrefix), rule.Name)
 
-		var triggerTags []zabbix.Tag
+		// alertname tag lets zal bridge scope Zabbix maintenance to the trigger
+		triggerTags := []zabbix.Tag{{Tag: AlertNameTag, Value: rule.Name}}
 		for k, v := range hostConfig.TriggerTags {
-			triggerTags = append(triggerTags, zabbix.Tag{Tag: k, Value: v})
+			if k != AlertNameTag {
+				triggerTags = append(triggerTags, zabbix.Tag{Tag: k, Value: v})
+			}
 		}
 
 		newItem := &CustomItem{
@@ -160,9 +178,9 @@ func (p *Provisioner) LoadRulesFromPrometheus(hostConfig HostConfig) error {
 				Key:          key,
 				HostId:       "", //To be filled when the host will be created
 				Type:         2,  //Trapper
-				ValueType:    3,
+				ValueType:    itemValueType(hostConfig.ValueEncoding),
 				History:      hostConfig.ItemDefaultHistory,
-				Trends:       hostConfig.ItemDefaultTrends,
+				Trends:       itemTrends(hostConfig.ValueEncoding, hostConfig.ItemDefaultTrends),
 				TrapperHosts: hostConfig.ItemDefaultTrapperHosts,
 			},
 			Applications: map[string]struct{}{},
@@ -172,7 +190,7 @@ func (p *Provisioner) LoadRulesFromPrometheus(hostConfig HostConfig) error {
 			State: StateNew,
 			Trigger: zabbix.Trigger{
 				Description: rule.Name,
-				Expression:  fmt.Sprintf("{%s:%s.last()}<>0", newHost.Name, key),
+				Expression:  triggerExpression(hostConfig.ValueEncoding, newHost.Name, key),
 				ManualClose: 1,
 				Tags:        triggerTags,
 			},
@@ -199,10 +217,14 @@ func (p *Provisioner) LoadRulesFromPrometheus(hostConfig HostConfig) error {
 			newTrigger.Priority = GetZabbixPriority(v)
 		}
 
+		triggers := []*CustomTrigger{newTrigger}
+
 		// Add the special "No Data" trigger if requested
 		if delay, ok := rule.Annotations["zabbix_trigger_nodata"]; ok {
 			newTrigger.Trigger.Description = fmt.Sprintf("%s - no data for the last %s seconds", newTrigger.Trigger.Description, delay)
 			newTrigger.Trigger.Expression = fmt.Sprintf("{%s:%s.nodata(%s)}", newHost.Name, key, delay)
+		} else if hostConfig.ValueEncoding == itemvalue.Severity {
+			triggers = severityTriggers(newTrigger, newHost.Name, key)
 		}
 
 		// If no applications are found in the rule, add the default application declared in the configuration
@@ -219,8 +241,32 @@ func (p *Provisioner) LoadRulesFromPrometheus(hostConfig HostConfig) error {
 		log.Debugf("Loading item from Prometheus: %+v", newItem)
 		newHost.AddItem(newItem)
 
-		log.Debugf("Loading trigger from Prometheus: %+v", newTrigger)
-		newHost.AddTrigger(newTrigger)
+		if p.samples.Declared(rule.Labels, rule.Annotations) {
+			sampleItem := &CustomItem{
+				State: StateNew,
+				Item: zabbix.Item{
+					Name:         fmt.Sprintf("%s %s", rule.Name, p.samples.Suffix()),
+					Key:          p.keys.SuffixedKey(strings.ToLower(p.keyPrefix), rule.Name, p.samples.Suffix()),
+					Type:         2, //Trapper
+					ValueType:    zabbix.Float,
+					History:      hostConfig.ItemDefaultHistory,
+					Trends:       hostConfig.ItemDefaultTrends,
+					TrapperHosts: hostConfig.ItemDefaultTrapperHosts,
+				},
+				Applications: map[string]struct{}{},
+			}
+			for app := range newItem.Applications {
+				sampleItem.Applications[app] = struct{}{}
+			}
+
+			log.Debugf("Loading sample item from Prometheus: %+v", sampleItem)
+			newHost.AddItem(sampleItem)
+		}
+
+		for _, trigger := range triggers {
+			log.Debugf("Loading trigger from Prometheus: %+v", trigger)
+			newHost.AddTrigger(trigger)
+		}
 
 	}
 	log.Debugf("Host from Prometheus: %+v", newHost)
@@ -350,6 +396,7 @@ func (p *Provisioner) LoadDataFromZabbix() error {
 			"output":           "extend",
 			"hostids":          oldHost.Host.HostId,
 			"expandExpression": true,
+			"selectTags":       "extend",
 		})
 		if err != nil {
 			return errors.Wrapf(err, "error getting zabbix triggers, hostids: %v", oldHost.Host.HostId)
@@ -475,3 +522,50 @@ func (p *Provisioner) ApplyChanges() error {
 	}
 	return nil
 }
+
+// itemValueType returns the value type of items receiving values of the encoding.
+func itemValueType(encoding string) zabbix.ValueType {
+	switch encoding {
+	case itemvalue.String:
+		return zabbix.Character
+	case itemvalue.JSON:
+		return zabbix.Text
+	default:
+		return zabbix.Unsigned
+	}
+}
+
+// itemTrends returns trends of items receiving values of the encoding, Zabbix keeps no trends of strings.
+func itemTrends(encoding, trends string) string {
+	if itemValueType(encoding) != zabbix.Unsigned {
+		return "0"
+	}
+	return trends
+}
+
+// triggerExpression returns expression of trigger firing while the item value is a firing alert.
+func triggerExpression(encoding, host, key string) string {
+	switch encoding {
+	case itemvalue.String:
+		return fmt.Sprintf("{%s:%s.str(%s)}=1", host, key, itemvalue.Problem)
+	case itemvalue.JSON:
+		// status is the first field, labels can't start the document
+		return fmt.Sprintf(`{%s:%s.str("{\"status\":\"firing\"")}=1`, host, key)
+	default:
+		return fmt.Sprintf("{%s:%s.last()}<>0", host, key)
+	}
+}
+
+// severityTriggers returns a trigger of every Zabbix severity, each of them fires while the item
+// value is its severity, so severity changes of an alert fire triggers of the new severity.
+func severityTriggers(trigger *CustomTrigger, host, key string) []*CustomTrigger {
+	var triggers []*CustomTrigger
+	for p := zabbix.Information; p <= zabbix.Critical; p++ {
+		t := *trigger
+		t.Description = fmt.Sprintf("%s (%s)", trigger.Description, GetPrometheusSeverity(p))
+		t.Expression = fmt.Sprintf("{%s:%s.last()}=%d", host, key, p)
+		t.Priority = p
+		triggers = append(triggers, &t)
+	}
+	return triggers
+}
@@ -1,8 +1,7 @@
 package provisioner
 
 import (
-	"strings"
-
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
 	zabbix "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixclient"
 	log "github.com/sirupsen/logrus"
 )
@@ -184,6 +183,10 @@ func (i *CustomItem) Equal(j *CustomItem) bool {
 		return false
 	}
 
+	if i.ValueType != j.ValueType {
+		return false
+	}
+
 	if i.Trends != j.Trends {
 		return false
 	}
@@ -234,6 +237,21 @@ func (i *CustomTrigger) Equal(j *CustomTrigger) bool {
 		return false
 	}
 
+	if len(i.Tags) != len(j.Tags) {
+		return false
+	}
+
+	tags := make(map[zabbix.Tag]struct{}, len(i.Tags))
+	for _, tag := range i.Tags {
+		tags[tag] = struct{}{}
+	}
+
+	for _, tag := range j.Tags {
+		if _, ok := tags[tag]; !ok {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -390,19 +408,23 @@ func (host *CustomHost) GetApplicationsByState() (applicationsByState map[State]
 }
 
 func GetZabbixPriority(severity string) zabbix.PriorityType {
+	return zabbix.PriorityType(itemvalue.Priority(severity))
+}
 
-	switch strings.ToLower(severity) {
-	case "information":
-		return zabbix.Information
-	case "warning":
-		return zabbix.Warning
-	case "average":
-		return zabbix.Average
-	case "high":
-		return zabbix.High
-	case "critical":
-		return zabbix.Critical
+// GetPrometheusSeverity is the reverse of GetZabbixPriority.
+func GetPrometheusSeverity(priority zabbix.PriorityType) string {
+	switch priority {
+	case zabbix.Information:
+		return "information"
+	case zabbix.Warning:
+		return "warning"
+	case zabbix.Average:
+		return "average"
+	case zabbix.High:
+		return "high"
+	case zabbix.Critical:
+		return "critical"
 	default:
-		return zabbix.NotClassified
+		return "not_classified"
 	}
 }
@@ -65,6 +65,9 @@ type Item struct {
 	History      string    `json:"history,omitempty"`
 	Trends       string    `json:"trends,omitempty"`
 	TrapperHosts string    `json:"trapper_hosts,omitempty"`
+	// LastValue and LastClock are read only, returned by item.get.
+	LastValue string `json:"lastvalue,omitempty"`
+	LastClock int64  `json:"lastclock,omitempty"`
 
 	ApplicationIds []string `json:"applications,omitempty"`
 }
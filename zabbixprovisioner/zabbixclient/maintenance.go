@@ -0,0 +1,149 @@
+package zabbix
+
+import (
+	reflector "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixutil"
+)
+
+type (
+	MaintenanceType int
+	TimePeriodType  int
+	TagsEvalType    int
+	TagOperator     int
+)
+
+const (
+	MaintenanceWithData MaintenanceType = 0
+	MaintenanceNoData   MaintenanceType = 1
+
+	TimePeriodOneTime TimePeriodType = 0
+	TimePeriodDaily   TimePeriodType = 2
+	TimePeriodWeekly  TimePeriodType = 3
+	TimePeriodMonthly TimePeriodType = 4
+
+	TagsAndOr TagsEvalType = 0
+	TagsOr    TagsEvalType = 2
+
+	TagEquals   TagOperator = 0
+	TagContains TagOperator = 2
+)
+
+// https://www.zabbix.com/documentation/4.0/manual/api/reference/maintenance/object
+type Maintenance struct {
+	MaintenanceId   string           `json:"maintenanceid,omitempty"`
+	Name            string           `json:"name"`
+	Description     string           `json:"description"`
+	MaintenanceType MaintenanceType  `json:"maintenance_type"`
+	ActiveSince     int64            `json:"active_since"`
+	ActiveTill      int64            `json:"active_till"`
+	TagsEvalType    TagsEvalType     `json:"tags_evaltype"`
+	TimePeriods     []TimePeriod     `json:"timeperiods"`
+	Tags            []MaintenanceTag `json:"tags,omitempty"`
+
+	// HostIds and GroupIds are used only when creating or updating maintenances.
+	HostIds  []string `json:"hostids,omitempty"`
+	GroupIds []string `json:"groupids,omitempty"`
+
+	// Hosts and Groups are returned when selectHosts and selectGroups are set.
+	Hosts  Hosts      `json:"-"`
+	Groups HostGroups `json:"-"`
+}
+
+// TimePeriod is maintenance time period, StartTime is seconds since midnight and Period is in seconds.
+// DayOfWeek and Month are bit masks starting with Monday and January.
+type TimePeriod struct {
+	TimePeriodType TimePeriodType `json:"timeperiod_type"`
+	Every          int            `json:"every,omitempty"`
+	Month          int            `json:"month,omitempty"`
+	DayOfWeek      int            `json:"dayofweek,omitempty"`
+	Day            int            `json:"day,omitempty"`
+	StartTime      int64          `json:"start_time,omitempty"`
+	Period         int64          `json:"period"`
+	StartDate      int64          `json:"start_date,omitempty"`
+}
+
+// MaintenanceTag limits maintenance to problems with matching tags.
+type MaintenanceTag struct {
+	Tag      string      `json:"tag"`
+	Operator TagOperator `json:"operator"`
+	Value    string      `json:"value"`
+}
+
+type Maintenances []Maintenance
+
+// Wrapper for maintenance.get: https://www.zabbix.com/documentation/4.0/manual/api/reference/maintenance/get
+func (api *API) MaintenancesGet(params Params) (Maintenances, error) {
+	var res Maintenances
+	if _, present := params["output"]; !present {
+		params["output"] = "extend"
+	}
+	response, err := api.CallWithError("maintenance.get", params)
+	if err != nil {
+		return nil, err
+	}
+
+	results := response.Result.([]interface{})
+	reflector.MapsToStructs2(results, &res, reflector.Strconv, "json")
+
+	for i := range results {
+		maintenance := results[i].(map[string]interface{})
+
+		if timeperiods, ok := maintenance["timeperiods"].([]interface{}); ok {
+			reflector.MapsToStructs2(timeperiods, &res[i].TimePeriods, reflector.Strconv, "json")
+		}
+
+		if tags, ok := maintenance["tags"].([]interface{}); ok {
+			reflector.MapsToStructs2(tags, &res[i].Tags, reflector.Strconv, "json")
+		}
+
+		if hosts, ok := maintenance["hosts"].([]interface{}); ok {
+			reflector.MapsToStructs2(hosts, &res[i].Hosts, reflector.Strconv, "json")
+		}
+
+		if groups, ok := maintenance["groups"].([]interface{}); ok {
+			reflector.MapsToStructs2(groups, &res[i].Groups, reflector.Strconv, "json")
+		}
+	}
+
+	return res, nil
+}
+
+// Wrapper for maintenance.create: https://www.zabbix.com/documentation/4.0/manual/api/reference/maintenance/create
+func (api *API) MaintenancesCreate(maintenances Maintenances) error {
+	response, err := api.CallWithError("maintenance.create", maintenances)
+	if err != nil {
+		return err
+	}
+
+	result := response.Result.(map[string]interface{})
+	maintenanceids := result["maintenanceids"].([]interface{})
+	for i, id := range maintenanceids {
+		maintenances[i].MaintenanceId = id.(string)
+	}
+	return nil
+}
+
+// Wrapper for maintenance.update: https://www.zabbix.com/documentation/4.0/manual/api/reference/maintenance/update
+// Hosts, groups, time periods and tags of the maintenance are replaced.
+func (api *API) MaintenancesUpdate(maintenances Maintenances) error {
+	_, err := api.CallWithError("maintenance.update", maintenances)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Wrapper for maintenance.delete: https://www.zabbix.com/documentation/4.0/manual/api/reference/maintenance/delete
+func (api *API) MaintenancesDeleteByIds(ids []string) error {
+	response, err := api.CallWithError("maintenance.delete", ids)
+	if err != nil {
+		return err
+	}
+
+	result := response.Result.(map[string]interface{})
+	maintenanceids, ok := result["maintenanceids"].([]interface{})
+	if !ok || len(ids) != len(maintenanceids) {
+		err = &ExpectedMore{len(ids), len(maintenanceids)}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package zabbix
+
+import (
+	reflector "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixutil"
+)
+
+const (
+	// Acknowledge action flags, https://www.zabbix.com/documentation/4.0/manual/api/reference/event/acknowledge
+	ActionClose          = 1
+	ActionAcknowledge    = 2
+	ActionMessage        = 4
+	ActionChangeSeverity = 8
+)
+
+// ProblemEvent is the problem object, named to not clash with the Problem trigger value.
+// https://www.zabbix.com/documentation/4.0/manual/api/reference/problem/object
+type ProblemEvent struct {
+	EventId      string        `json:"eventid"`
+	Source       int           `json:"source"`
+	Object       int           `json:"object"`
+	ObjectId     string        `json:"objectid"`
+	Clock        int64         `json:"clock"`
+	REventId     string        `json:"r_eventid"`
+	Name         string        `json:"name"`
+	Acknowledged int           `json:"acknowledged"`
+	Severity     PriorityType  `json:"severity"`
+	Suppressed   int           `json:"suppressed"`
+	Acknowledges []Acknowledge `json:"acknowledges"`
+	Tags         []Tag         `json:"tags"`
+}
+
+// Acknowledge is returned by problem.get and event.get when selectAcknowledges is set.
+type Acknowledge struct {
+	AcknowledgeId string `json:"acknowledgeid"`
+	UserId        string `json:"userid"`
+	EventId       string `json:"eventid"`
+	Clock         int64  `json:"clock"`
+	Message       string `json:"message"`
+	Action        int    `json:"action"`
+	// Alias, Username, Name and Surname are returned depending on the Zabbix version.
+	Alias    string `json:"alias"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Surname  string `json:"surname"`
+}
+
+// User returns the login of the user who acknowledged the problem.
+func (a *Acknowledge) User() string {
+	switch {
+	case a.Username != "":
+		return a.Username
+	case a.Alias != "":
+		return a.Alias
+	default:
+		return "userid " + a.UserId
+	}
+}
+
+type ProblemEvents []ProblemEvent
+
+// tagsFromResult converts tags selected with selectTags.
+func tagsFromResult(v interface{}) []Tag {
+	results, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var tags []Tag
+	reflector.MapsToStructs2(results, &tags, reflector.Strconv, "json")
+	return tags
+}
+
+// Wrapper for problem.get: https://www.zabbix.com/documentation/4.0/manual/api/reference/problem/get
+func (api *API) ProblemsGet(params Params) (ProblemEvents, error) {
+	var res ProblemEvents
+	if _, present := params["output"]; !present {
+		params["output"] = "extend"
+	}
+	response, err := api.CallWithError("problem.get", params)
+	if err != nil {
+		return nil, err
+	}
+
+	results := response.Result.([]interface{})
+	reflector.MapsToStructs2(results, &res, reflector.Strconv, "json")
+
+	for i := range results {
+		problem := results[i].(map[string]interface{})
+
+		if acknowledges, ok := problem["acknowledges"].([]interface{}); ok {
+			reflector.MapsToStructs2(acknowledges, &res[i].Acknowledges, reflector.Strconv, "json")
+		}
+
+		res[i].Tags = tagsFromResult(problem["tags"])
+	}
+
+	return res, nil
+}
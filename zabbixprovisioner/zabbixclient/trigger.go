@@ -1,6 +1,8 @@
 package zabbix
 
 import (
+	"reflect"
+
 	reflector "github.com/devopyio/zabbix-alertmanager/zabbixprovisioner/zabbixutil"
 )
 
@@ -35,6 +37,11 @@ type Trigger struct {
 	Priority    PriorityType `json:"priority"`
 	Status      StatusType   `json:"status"`
 	Tags        []Tag        `json:"tags"`
+
+	// LastChange is the time of the last trigger value change, returned by trigger.get.
+	LastChange int64 `json:"-"`
+	// Hosts are returned when selectHosts is set.
+	Hosts Hosts `json:"-"`
 }
 
 type Tag struct {
@@ -54,7 +61,28 @@ func (api *API) TriggersGet(params Params) (Triggers, error) {
 		return nil, err
 	}
 
-	reflector.MapsToStructs2(response.Result.([]interface{}), &res, reflector.Strconv, "json")
+	results := response.Result.([]interface{})
+	reflector.MapsToStructs2(results, &res, reflector.Strconv, "json")
+
+	for i := range results {
+		trigger := results[i].(map[string]interface{})
+
+		// value and lastchange are read only, they are not sent on create and update.
+		if v, ok := trigger["value"]; ok {
+			res[i].Value = ValueType(reflector.Strconv(v, reflect.Int).(int64))
+		}
+		if v, ok := trigger["lastchange"]; ok {
+			res[i].LastChange = reflector.Strconv(v, reflect.Int64).(int64)
+		}
+
+		if _, ok := params["selectTags"]; ok {
+			res[i].Tags = tagsFromResult(trigger["tags"])
+		}
+
+		if hosts, ok := trigger["hosts"].([]interface{}); ok {
+			reflector.MapsToStructs2(hosts, &res[i].Hosts, reflector.Strconv, "json")
+		}
+	}
 	return res, nil
 }
 
@@ -1,20 +1,29 @@
 package zabbixsnd
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"io/ioutil"
 	"net"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 var Header = []byte("ZBXD\x01")
 
+var tracer = otel.Tracer("github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd")
+
 type Metric struct {
 	Host  string `json:"host"`
 	Key   string `json:"key"`
 	Value string `json:"value"`
 	Clock int64  `json:"clock"`
+	// NS is the nanoseconds part of the value time, zero is omitted.
+	NS int64 `json:"ns,omitempty"`
 }
 
 type Packet struct {
@@ -64,6 +73,30 @@ func New(addr string) (*Sender, error) {
 
 // Send method Sender class, send packet to zabbix
 func (s *Sender) Send(packet *Packet) ([]byte, error) {
+	return s.SendContext(context.Background(), packet)
+}
+
+// SendContext sends packet to zabbix, the TCP exchange is traced as a child span of ctx.
+func (s *Sender) SendContext(ctx context.Context, packet *Packet) ([]byte, error) {
+	_, span := tracer.Start(ctx, "zabbixsnd.Send")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("net.peer.name", s.addr.String()),
+		attribute.Int("zabbix.metrics", len(packet.Data)),
+	)
+
+	res, err := s.send(packet)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("zabbix.response_bytes", len(res)))
+
+	return res, nil
+}
+
+func (s *Sender) send(packet *Packet) ([]byte, error) {
 	conn, err := net.DialTCP("tcp", nil, s.addr)
 	if err != nil {
 		return nil, err
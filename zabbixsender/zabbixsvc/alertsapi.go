@@ -0,0 +1,266 @@
+package zabbixsvc
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/common/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// AlertsAPIPath is the Alertmanager api path Prometheus pushes alerts to.
+const AlertsAPIPath = "/api/v2/alerts"
+
+var trackedAlerts = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "alerts_api_tracked_alerts",
+		Help: "Current number of alerts pushed by Prometheus by status",
+	},
+	[]string{"alert_status"},
+)
+
+// PostableAlert is alert pushed by Prometheus to the Alertmanager api.
+type PostableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+}
+
+type trackedAlert struct {
+	alert  PostableAlert
+	endsAt time.Time
+}
+
+func (a *trackedAlert) firing(now time.Time) bool {
+	return a.endsAt.After(now)
+}
+
+// AlertsAPI acts as Alertmanager for Prometheus. Prometheus resends active alerts periodically
+// and never sends a resolve notification, so alerts are resolved when their endsAt expires.
+// Zabbix keys are derived from alertname, a key is firing while any of its alerts is firing.
+type AlertsAPI struct {
+	Handler *JSONHandler
+	// Receiver is used to resolve the Zabbix host of the pushed alerts.
+	Receiver string
+	// ResolveTimeout is used as endsAt of alerts which don't have one.
+	ResolveTimeout time.Duration
+	// Retention is how long resolved alerts are remembered, so that resent resolved alerts are not sent again.
+	Retention time.Duration
+
+	mu     sync.Mutex
+	alerts map[model.Fingerprint]*trackedAlert
+	// sent keeps keys last sent to Zabbix.
+	sent map[string]sentKey
+}
+
+// sentKey is the state of a key last sent to Zabbix and the alertname it was sent for.
+type sentKey struct {
+	alertName string
+	firing    bool
+}
+
+// NewAlertsAPI creates AlertsAPI sending alerts through h.
+func NewAlertsAPI(h *JSONHandler, receiver string, resolveTimeout time.Duration) *AlertsAPI {
+	return &AlertsAPI{
+		Handler:        h,
+		Receiver:       receiver,
+		ResolveTimeout: resolveTimeout,
+		Retention:      time.Hour,
+		alerts:         map[model.Fingerprint]*trackedAlert{},
+		sent:           map[string]sentKey{},
+	}
+}
+
+func fingerprint(labels map[string]string) model.Fingerprint {
+	ls := make(model.LabelSet, len(labels))
+	for k, v := range labels {
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return ls.Fingerprint()
+}
+
+// HandlePost handles alerts pushed by Prometheus.
+func (a *AlertsAPI) HandlePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := startSpan(r, "AlertsAPI.HandlePost")
+	defer span.End()
+	defer r.Body.Close()
+
+	var alerts []PostableAlert
+	if err := decode(ctx, r.Body, &alerts); err != nil {
+		alertsErrorsTotal.WithLabelValues("", "").Inc()
+
+		log.Errorf("error decoding prometheus alerts: %v", err)
+		http.Error(w, "request body is not valid json", http.StatusBadRequest)
+		return
+	}
+
+	for _, alert := range alerts {
+		if alert.Labels["alertname"] == "" {
+			alertsErrorsTotal.WithLabelValues("", a.Receiver).Inc()
+			http.Error(w, "missing fields in request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := a.update(ctx, alerts, time.Now()); err != nil {
+		http.Error(w, "failed to send to server", http.StatusInternalServerError)
+	}
+}
+
+// update merges pushed alerts into tracked alerts and sends changed keys to Zabbix.
+func (a *AlertsAPI) update(ctx context.Context, alerts []PostableAlert, now time.Time) error {
+	a.mu.Lock()
+	for _, alert := range alerts {
+		endsAt := alert.EndsAt
+		if endsAt.IsZero() {
+			endsAt = now.Add(a.ResolveTimeout)
+		}
+
+		a.alerts[fingerprint(alert.Labels)] = &trackedAlert{alert: alert, endsAt: endsAt}
+	}
+	n, sent := a.changes(now)
+	a.mu.Unlock()
+
+	return a.send(ctx, n, sent)
+}
+
+// Expire resolves alerts whose endsAt passed and forgets old resolved alerts.
+func (a *AlertsAPI) Expire(now time.Time) error {
+	a.mu.Lock()
+	for fp, alert := range a.alerts {
+		if !alert.firing(now) && now.Sub(alert.endsAt) > a.Retention {
+			delete(a.alerts, fp)
+		}
+	}
+	n, sent := a.changes(now)
+	a.mu.Unlock()
+
+	return a.send(context.Background(), n, sent)
+}
+
+// Run expires alerts every interval until stop is closed.
+func (a *AlertsAPI) Run(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			if err := a.Expire(now); err != nil {
+				log.Errorf("failed to send expired alerts, will retry: %v", err)
+			}
+		}
+	}
+}
+
+// changes returns the notification of keys whose firing state differs from the state last sent to Zabbix,
+// and the sent state of the keys to record once it is sent, nil forgets the key. The notification is nil
+// when nothing changed. a.mu must be held.
+func (a *AlertsAPI) changes(now time.Time) (*Notification, map[string]*sentKey) {
+	latest := map[string]*trackedAlert{}
+	firing := map[string]bool{}
+	var active int
+
+	for _, alert := range a.alerts {
+		name := a.Handler.key(alert.alert.Labels["alertname"])
+		isFiring := alert.firing(now)
+		if isFiring {
+			active++
+		}
+
+		if isFiring && !firing[name] || latest[name] == nil {
+			latest[name] = alert
+		}
+		firing[name] = firing[name] || isFiring
+	}
+
+	trackedAlerts.WithLabelValues("firing").Set(float64(active))
+	trackedAlerts.WithLabelValues("resolved").Set(float64(len(a.alerts) - active))
+
+	names := make([]string, 0, len(latest))
+	for name := range latest {
+		if sent, ok := a.sent[name]; !ok || sent.firing != firing[name] {
+			names = append(names, name)
+		}
+	}
+	for name, sent := range a.sent {
+		if _, ok := latest[name]; ok {
+			continue
+		}
+		if sent.firing {
+			// Forgotten alerts were resolved before, but not successfully sent.
+			names = append(names, name)
+		} else {
+			delete(a.sent, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	n := &Notification{Receiver: a.Receiver, Status: "resolved"}
+	sent := make(map[string]*sentKey, len(names))
+	for _, name := range names {
+		alert := Alert{Status: "resolved", Labels: map[string]string{"alertname": a.sent[name].alertName}, receivedAt: now}
+		sent[name] = nil
+		if t, ok := latest[name]; ok {
+			alert.Labels = t.alert.Labels
+			alert.Annotations = t.alert.Annotations
+			alert.StartsAt = t.alert.StartsAt.Format(time.RFC3339)
+			alert.EndsAt = t.endsAt.Format(time.RFC3339)
+			sent[name] = &sentKey{alertName: t.alert.Labels["alertname"], firing: firing[name]}
+		}
+		if firing[name] {
+			alert.Status = "firing"
+			n.Status = "firing"
+		}
+		n.Alerts = append(n.Alerts, alert)
+	}
+
+	return n, sent
+}
+
+// send sends the changed keys like any other notification and records their sent state. Keys are sent also
+// in async mode, so the state of keys which fail is not recorded and they are sent again. It doesn't hold a.mu,
+// so pushes and expiry don't wait for Zabbix. When concurrent sends record the state of a key out of order,
+// the key differs from its alerts and is sent again by the next sync, values older than the values sent
+// before are dropped by the handler Order.
+func (a *AlertsAPI) send(ctx context.Context, n *Notification, sent map[string]*sentKey) error {
+	if n == nil {
+		return nil
+	}
+
+	if result, code := a.Handler.notify(ctx, n, false); code >= http.StatusBadRequest {
+		return errors.Errorf("failed to send alerts, code: %d, error: %s", code, result.Error)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for name, s := range sent {
+		if s == nil {
+			delete(a.sent, name)
+		} else {
+			a.sent[name] = *s
+		}
+	}
+
+	return nil
+}
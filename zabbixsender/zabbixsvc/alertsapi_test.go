@@ -0,0 +1,179 @@
+package zabbixsvc_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+func postAlerts(t *testing.T, a *zabbixsvc.AlertsAPI, body string) {
+	rr := httptest.NewRecorder()
+	a.HandlePost(rr, httptest.NewRequest("POST", zabbixsvc.AlertsAPIPath, strings.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code, rr.Body.String())
+	}
+}
+
+func expectPacket(t *testing.T, packets <-chan *zabbixsnd.Packet, expected map[string]string) {
+	select {
+	case p := <-packets:
+		if len(p.Data) != len(expected) {
+			t.Fatalf("Expected %d metrics, got %+v", len(expected), p.Data)
+		}
+		for _, m := range p.Data {
+			if expected[m.Key] != m.Value {
+				t.Fatalf("Unexpected metric %s=%s, expected %v", m.Key, m.Value, expected)
+			}
+		}
+	default:
+		if expected != nil {
+			t.Fatalf("Expected packet with %v, got none", expected)
+		}
+	}
+}
+
+func TestAlertsAPI(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Hosts:       map[string]string{"prometheus": "prom"},
+	}
+	a := zabbixsvc.NewAlertsAPI(h, "prometheus", 5*time.Minute)
+
+	now := time.Now()
+	endsAt := now.Add(time.Hour).Format(time.RFC3339)
+	firing := fmt.Sprintf(`[
+		{"labels": {"alertname": "InstanceDown", "instance": "a"}, "startsAt": "%[1]s", "endsAt": "%[2]s"},
+		{"labels": {"alertname": "InstanceDown", "instance": "b"}, "startsAt": "%[1]s", "endsAt": "%[2]s"},
+		{"labels": {"alertname": "DiskFull"}, "startsAt": "%[1]s"}
+	]`, now.Format(time.RFC3339), endsAt)
+
+	postAlerts(t, a, firing)
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1", "prometheus.diskfull": "1"})
+
+	// resent active alerts don't change anything
+	postAlerts(t, a, firing)
+	expectPacket(t, packets, nil)
+
+	// one of the instances resolved, but the key is still firing
+	postAlerts(t, a, fmt.Sprintf(`[{"labels": {"alertname": "InstanceDown", "instance": "a"}, "endsAt": "%s"}]`, now.Add(-time.Minute).Format(time.RFC3339)))
+	expectPacket(t, packets, nil)
+
+	// DiskFull has no endsAt and expires after resolve timeout
+	if err := a.Expire(now.Add(10 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket(t, packets, map[string]string{"prometheus.diskfull": "0"})
+
+	if err := a.Expire(now.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "0"})
+
+	if err := a.Expire(now.Add(5 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket(t, packets, nil)
+}
+
+func TestAlertsAPIFiresAgainAfterExpiry(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Order:       zabbixsvc.NewOrder(),
+	}
+	a := zabbixsvc.NewAlertsAPI(h, "prometheus", 5*time.Minute)
+
+	now := time.Now()
+	startsAt := now.Add(-time.Hour).Format(time.RFC3339Nano)
+	postAlerts(t, a, fmt.Sprintf(`[{"labels": {"alertname": "InstanceDown"}, "startsAt": "%s", "endsAt": "%s"}]`,
+		startsAt, now.Add(10*time.Millisecond).Format(time.RFC3339Nano)))
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+
+	time.Sleep(20 * time.Millisecond)
+	if err := a.Expire(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "0"})
+
+	// Prometheus pushes the alert again with its original startsAt, before the expiry
+	postAlerts(t, a, fmt.Sprintf(`[{"labels": {"alertname": "InstanceDown"}, "startsAt": "%s"}]`, startsAt))
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+}
+
+func TestAlertsAPIMissingFields(t *testing.T) {
+	a := zabbixsvc.NewAlertsAPI(&zabbixsvc.JSONHandler{}, "prometheus", 5*time.Minute)
+
+	for _, body := range []string{`[{"labels": {}}]`, `{"labels": {"alertname": "A"}}`} {
+		rr := httptest.NewRecorder()
+		a.HandlePost(rr, httptest.NewRequest("POST", zabbixsvc.AlertsAPIPath, strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected bad request for %s, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestAlertsAPIAsync(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	s, packets := fakeZabbixFunc(t, func(*zabbixsnd.Packet) string {
+		if fail.Load() {
+			return "processed: 0; failed: 1; total: 1; seconds spent: 0.000041"
+		}
+		return "processed: 1; failed: 0; total: 1; seconds spent: 0.000041"
+	})
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Requests:    zabbixsvc.NewRequestLog(10),
+	}
+	h.Async = zabbixsvc.NewAsync(h, zabbixsvc.AsyncConfig{Enabled: true, QueueSize: 1, Workers: 1})
+	a := zabbixsvc.NewAlertsAPI(h, "prometheus", 5*time.Minute)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go h.Async.Run(stop)
+
+	// keys are sent within the request also in async mode, so failures are not lost
+	rr := httptest.NewRecorder()
+	a.HandlePost(rr, httptest.NewRequest("POST", zabbixsvc.AlertsAPIPath, strings.NewReader(`[{"labels": {"alertname": "InstanceDown"}}]`)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected failed send, got %d", rr.Code)
+	}
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+
+	// the failed key is sent again by the next sync
+	fail.Store(false)
+	if err := a.Expire(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+
+	if err := a.Expire(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	expectPacket(t, packets, nil)
+
+	var codes []int
+	for _, r := range h.Requests.List() {
+		codes = append(codes, r.Code)
+	}
+	if fmt.Sprint(codes) != "[200 500]" {
+		t.Fatalf("Expected sent and failed notifications, got %v", codes)
+	}
+}
@@ -0,0 +1,247 @@
+package zabbixsvc
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	asyncQueueLength = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "async_queue_length",
+			Help: "Number of queued Zabbix sends in async mode",
+		},
+	)
+
+	asyncQueueCapacity = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "async_queue_capacity",
+			Help: "Maximum number of queued Zabbix sends in async mode",
+		},
+	)
+
+	asyncWorkers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "async_workers",
+			Help: "Number of async workers sending to Zabbix",
+		},
+	)
+
+	asyncWorkersBusy = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "async_workers_busy",
+			Help: "Number of async workers currently sending to Zabbix",
+		},
+	)
+
+	asyncWorkerBusySeconds = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "async_worker_busy_seconds_total",
+			Help: "Total time async workers spent sending to Zabbix, divide the rate by async_workers for utilisation",
+		},
+	)
+
+	asyncLostAlertsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "async_lost_alerts_total",
+			Help: "Number of queued alerts dropped after their Zabbix send failed",
+		},
+	)
+
+	asyncRejectedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "async_rejected_total",
+			Help: "Number of notifications rejected in async mode by reason",
+		},
+		[]string{"reason"},
+	)
+)
+
+// AsyncConfig configures asynchronous delivery of alerts.
+type AsyncConfig struct {
+	// Enabled answers alert requests with 202 once they are queued.
+	Enabled bool `yaml:"enabled"`
+	// QueueSize is the maximum number of queued sends, requests are rejected with 429 when it is full.
+	QueueSize int `yaml:"queueSize"`
+	// Workers is the number of concurrent Zabbix sends.
+	Workers int `yaml:"workers"`
+}
+
+// Validate checks queue size and workers of enabled async mode.
+func (cfg AsyncConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Workers <= 0 {
+		return errors.Errorf("workers: must be positive, got %d", cfg.Workers)
+	}
+
+	if cfg.QueueSize <= 0 {
+		return errors.Errorf("queueSize: must be positive, got %d", cfg.QueueSize)
+	}
+
+	return nil
+}
+
+// Async sends notifications to Zabbix in the background with a fixed pool of workers.
+// Metrics of the same host and key are always sent by the same worker, so their order is kept.
+type Async struct {
+	Handler *JSONHandler
+
+	mu      sync.Mutex
+	stopped bool
+	queued  int
+	size    int
+	queues  []chan *asyncJob
+}
+
+// asyncJob is a part of a notification sent by a single worker.
+type asyncJob struct {
+	n       *Notification
+	host    string
+	metrics []*zabbixsnd.Metric
+	// link points to the span of the request which queued the job.
+	link trace.Link
+}
+
+// NewAsync creates Async sending through h, workers are started by Run.
+func NewAsync(h *JSONHandler, cfg AsyncConfig) *Async {
+	a := &Async{
+		Handler: h,
+		size:    cfg.QueueSize,
+		queues:  make([]chan *asyncJob, cfg.Workers),
+	}
+	for i := range a.queues {
+		a.queues[i] = make(chan *asyncJob, cfg.QueueSize)
+	}
+
+	asyncQueueCapacity.Set(float64(cfg.QueueSize))
+	asyncWorkers.Set(float64(cfg.Workers))
+
+	return a
+}
+
+// Run starts the workers and waits until stop is closed. New notifications are rejected
+// after stop, while the queued ones are still sent.
+func (a *Async) Run(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, q := range a.queues {
+		wg.Add(1)
+		go func(q <-chan *asyncJob) {
+			defer wg.Done()
+			a.work(q)
+		}(q)
+	}
+
+	<-stop
+
+	a.mu.Lock()
+	a.stopped = true
+	for _, q := range a.queues {
+		close(q)
+	}
+	a.mu.Unlock()
+
+	wg.Wait()
+}
+
+// enqueue routes the notification and queues its metrics, split by the worker of each key.
+// It returns the result and the status code of the response.
+func (a *Async) enqueue(ctx context.Context, n *Notification) (*SendResult, int) {
+	n, host, metrics := a.Handler.route(ctx, n)
+	if len(metrics) == 0 {
+		return emptyResult(), http.StatusOK
+	}
+
+	link := trace.Link{SpanContext: trace.SpanContextFromContext(ctx)}
+	jobs := map[int]*asyncJob{}
+	for i, m := range metrics {
+		worker := a.worker(m)
+		job, ok := jobs[worker]
+		if !ok {
+			job = &asyncJob{n: &Notification{Receiver: n.Receiver, Status: n.Status}, host: host, link: link}
+			jobs[worker] = job
+		}
+		job.n.Alerts = append(job.n.Alerts, n.Alerts[i])
+		job.metrics = append(job.metrics, m)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopped {
+		asyncRejectedTotal.WithLabelValues("stopped").Inc()
+		return newSendResult(metrics, nil, errors.New("zal is shutting down")), http.StatusServiceUnavailable
+	}
+
+	if a.queued+len(jobs) > a.size {
+		asyncRejectedTotal.WithLabelValues("full").Inc()
+		log.Warnf("rejected alerts, async queue is full, receiver: %s", n.Receiver)
+		return newSendResult(metrics, nil, errors.New("queue is full")), http.StatusTooManyRequests
+	}
+
+	// queues can't block, each of them has capacity of the whole queue
+	for worker, job := range jobs {
+		a.queues[worker] <- job
+	}
+	a.queued += len(jobs)
+	asyncQueueLength.Set(float64(a.queued))
+
+	result := newSendResult(metrics, nil, nil)
+	result.Status = "queued"
+	return result, http.StatusAccepted
+}
+
+// Queued returns the number of queued sends and the size of the queue.
+func (a *Async) Queued() (queued, size int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.queued, a.size
+}
+
+// worker returns the index of the worker sending the host and key of the metric.
+func (a *Async) worker(m *zabbixsnd.Metric) int {
+	h := fnv.New32a()
+	h.Write([]byte(m.Host))
+	h.Write([]byte{0})
+	h.Write([]byte(m.Key))
+	return int(h.Sum32() % uint32(len(a.queues)))
+}
+
+// work sends queued jobs in order until the queue is closed.
+func (a *Async) work(q <-chan *asyncJob) {
+	for job := range q {
+		a.mu.Lock()
+		a.queued--
+		asyncQueueLength.Set(float64(a.queued))
+		a.mu.Unlock()
+
+		asyncWorkersBusy.Inc()
+		start := time.Now()
+
+		ctx, span := tracer.Start(context.Background(), "Async.send",
+			trace.WithLinks(job.link),
+			trace.WithAttributes(attribute.String("zabbix.host", job.host), attribute.Int("zabbix.keys", len(job.metrics))),
+		)
+		// errors are logged by deliver, sends were already retried, so alerts of failed ones are lost
+		if _, err := a.Handler.deliver(ctx, job.n, job.host, job.metrics); err != nil {
+			asyncLostAlertsTotal.Add(float64(len(job.n.Alerts)))
+		}
+		span.End()
+
+		asyncWorkerBusySeconds.Add(time.Since(start).Seconds())
+		asyncWorkersBusy.Dec()
+	}
+}
@@ -0,0 +1,90 @@
+package zabbixsvc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+func TestAsync(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+	}
+	h.Async = zabbixsvc.NewAsync(h, zabbixsvc.AsyncConfig{Enabled: true, QueueSize: 2, Workers: 4})
+
+	post := func(body string) int {
+		rr := httptest.NewRecorder()
+		h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(body)))
+		return rr.Code
+	}
+
+	// workers are not running yet, so requests stay queued
+	for _, body := range []string{alertInternal, alertOK} {
+		if code := post(body); code != http.StatusAccepted {
+			t.Fatalf("Expected accepted, got %d", code)
+		}
+	}
+	if code := post(alertInternal); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected full queue to be rejected, got %d", code)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		h.Async.Run(stop)
+		close(done)
+	}()
+
+	// firing and resolved values of the same key are sent in order
+	for _, value := range []string{"1", "0"} {
+		select {
+		case p := <-packets:
+			if len(p.Data) != 1 || p.Data[0].Key != "prometheus.instancedown" || p.Data[0].Value != value {
+				t.Fatalf("Expected value %s, got %+v", value, p.Data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected queued alerts to be sent")
+		}
+	}
+
+	close(stop)
+	<-done
+
+	if code := post(alertInternal); code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected stopped queue to reject alerts, got %d", code)
+	}
+}
+
+func TestAsyncDrain(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+	}
+	h.Async = zabbixsvc.NewAsync(h, zabbixsvc.AsyncConfig{Enabled: true, QueueSize: 2, Workers: 1})
+
+	for _, body := range []string{alertInternal, alertOK} {
+		if code, _ := post(t, h, body); code != http.StatusAccepted {
+			t.Fatalf("Expected accepted, got %d", code)
+		}
+	}
+
+	// stopped Run returns once the queued alerts are sent
+	stop := make(chan struct{})
+	close(stop)
+	h.Async.Run(stop)
+
+	if queued, _ := h.Async.Queued(); queued != 0 || len(packets) != 2 {
+		t.Fatalf("Expected queued alerts to be sent, %d queued, %d sent", queued, len(packets))
+	}
+}
@@ -0,0 +1,103 @@
+package zabbixsvc
+
+import (
+	"context"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var rejectedMetricsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "zabbix_rejected_metrics_total",
+		Help: "Number of metrics rejected by Zabbix by host and key, e.g. of missing hosts or items",
+	},
+	[]string{"host", "key"},
+)
+
+// bisect finds metrics Zabbix rejected, when failed of them were rejected in a single packet.
+// Halves of the metrics are sent again and only halves with failed metrics, counted from their
+// own Zabbix response, are split further. Zabbix doesn't report which metrics failed, so values
+// it accepted in the sent halves are stored again, in the order of metrics.
+func (h *JSONHandler) bisect(ctx context.Context, metrics []*zabbixsnd.Metric, failed int) ([]*zabbixsnd.Metric, error) {
+	if failed <= 0 {
+		return nil, nil
+	}
+	if failed >= len(metrics) {
+		return metrics, nil
+	}
+
+	left, right := metrics[:len(metrics)/2], metrics[len(metrics)/2:]
+
+	leftFailed, err := h.sendHalf(ctx, left)
+	if err != nil {
+		return nil, err
+	}
+
+	// rejected may be a part of metrics, so it is copied instead of appended to
+	rejected, err := h.bisect(ctx, left, leftFailed)
+	if err != nil {
+		return nil, err
+	}
+	rejected = append([]*zabbixsnd.Metric{}, rejected...)
+
+	// the right half was accepted when the left one has all the failed metrics, it is sent again only when
+	// it has values of keys in the left half, so that its newer values are the last ones stored
+	if leftFailed >= failed {
+		if sharesKey(left, right) {
+			if _, err := h.sendHalf(ctx, right); err != nil {
+				return nil, err
+			}
+		}
+		return rejected, nil
+	}
+
+	rightFailed, err := h.sendHalf(ctx, right)
+	if err != nil {
+		return nil, err
+	}
+
+	rightRejected, err := h.bisect(ctx, right, rightFailed)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rejected, rightRejected...), nil
+}
+
+// sharesKey reports whether metrics of b have the host and key of any of metrics of a.
+func sharesKey(a, b []*zabbixsnd.Metric) bool {
+	keys := make(map[string]bool, len(a))
+	for _, m := range a {
+		keys[m.Host+"\x00"+m.Key] = true
+	}
+	for _, m := range b {
+		if keys[m.Host+"\x00"+m.Key] {
+			return true
+		}
+	}
+	return false
+}
+
+// sendHalf sends a part of the bisected metrics and returns the number of metrics Zabbix failed.
+func (h *JSONHandler) sendHalf(ctx context.Context, metrics []*zabbixsnd.Metric) (int, error) {
+	res, failed, err := h.sendMetrics(ctx, metrics)
+	if err != nil {
+		return 0, err
+	}
+	if res.Response != "success" {
+		return 0, errors.Errorf("unexpected zabbix response: %s, info: %s", res.Response, res.Info)
+	}
+	return failed, nil
+}
+
+// logRejected logs and counts metrics rejected by Zabbix.
+func logRejected(rejected []*zabbixsnd.Metric) {
+	for _, m := range rejected {
+		rejectedMetricsTotal.WithLabelValues(m.Host, m.Key).Inc()
+		log.Errorf("zabbix rejected metric, check that the host and trapper item exist, host: '%s' key: '%s', value: '%s'", m.Host, m.Key, m.Value)
+	}
+}
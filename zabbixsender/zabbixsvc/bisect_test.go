@@ -0,0 +1,184 @@
+package zabbixsvc_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+const alertGroup = `{
+	"status": "firing",
+	"receiver": "testing",
+	"commonLabels": {"alertname": "InstanceDown"},
+	"alerts": [
+		{"labels": {"alertname": "InstanceDown"}},
+		{"labels": {"alertname": "DiskFull"}},
+		{"labels": {"alertname": "MissingItem"}},
+		{"labels": {"alertname": "HighLoad"}},
+		{"labels": {"alertname": "NoTrapper"}}
+	]
+}`
+
+func TestBisectRejected(t *testing.T) {
+	// items of keys starting with prometheus.missing or prometheus.notrapper don't exist
+	s, packets := fakeZabbixFunc(t, func(p *zabbixsnd.Packet) string {
+		var failed int
+		for _, m := range p.Data {
+			if strings.HasPrefix(m.Key, "prometheus.missing") || strings.HasPrefix(m.Key, "prometheus.notrapper") {
+				failed++
+			}
+		}
+		return fmt.Sprintf("processed: %d; failed: %d; total: %d; seconds spent: 0.000041", len(p.Data)-failed, failed, len(p.Data))
+	})
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:         s,
+		KeyPrefix:      "prometheus",
+		DefaultHost:    "host",
+		State:          zabbixsvc.NewState(),
+		BisectRejected: true,
+	}
+
+	rr := httptest.NewRecorder()
+	h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(alertGroup)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected rejected metrics not to be retried, got %d: %s", rr.Code, rr.Body)
+	}
+
+	var res zabbixsvc.SendResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rejected) != 2 || res.Rejected[0].Key != "prometheus.missingitem" || res.Rejected[1].Key != "prometheus.notrapper" {
+		t.Fatalf("Expected missing items to be rejected, got %+v", res.Rejected)
+	}
+	if res.Failed != 2 || res.Total != 5 {
+		t.Fatalf("Expected summary of the whole packet, got %+v", res)
+	}
+
+	// whole packet, [instancedown diskfull] without failures isn't split, [missingitem highload notrapper]
+	// is split into [missingitem] and [highload notrapper], which is split into [highload] and [notrapper]
+	var sent []int
+	for len(packets) > 0 {
+		sent = append(sent, len((<-packets).Data))
+	}
+	if fmt.Sprint(sent) != "[5 2 3 1 2 1 1]" {
+		t.Fatalf("Unexpected packet sizes: %v", sent)
+	}
+
+	if entries := h.State.List("host", ""); len(entries) != 3 {
+		t.Fatalf("Expected only accepted metrics in state, got %+v", entries)
+	}
+}
+
+func TestRejectedWithoutBisect(t *testing.T) {
+	s, _ := fakeZabbix(t, "processed: 4; failed: 1; total: 5; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+	}
+
+	rr := httptest.NewRecorder()
+	h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(alertGroup)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected error, got %d", rr.Code)
+	}
+}
+
+func TestBisectAcceptedRight(t *testing.T) {
+	// only the first metric is rejected
+	s, packets := fakeZabbixFunc(t, func(p *zabbixsnd.Packet) string {
+		failed := 0
+		if p.Data[0].Key == "prometheus.instancedown" {
+			failed = 1
+		}
+		return fmt.Sprintf("processed: %d; failed: %d; total: %d; seconds spent: 0.000041", len(p.Data)-failed, failed, len(p.Data))
+	})
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:         s,
+		KeyPrefix:      "prometheus",
+		DefaultHost:    "host",
+		BisectRejected: true,
+	}
+
+	code, res := post(t, h, alertGroup)
+	if code != http.StatusOK || len(res.Rejected) != 1 || res.Rejected[0].Key != "prometheus.instancedown" {
+		t.Fatalf("Expected instancedown to be rejected, got %d: %+v", code, res.Rejected)
+	}
+
+	// halves accepted by Zabbix are not sent again
+	var sent []int
+	for len(packets) > 0 {
+		sent = append(sent, len((<-packets).Data))
+	}
+	if fmt.Sprint(sent) != "[5 2 1]" {
+		t.Fatalf("Unexpected packet sizes: %v", sent)
+	}
+}
+
+func TestBisectDuplicateKey(t *testing.T) {
+	var mu sync.Mutex
+	var sent []int
+	last := map[string]string{}
+	s, _ := fakeZabbixFunc(t, func(p *zabbixsnd.Packet) string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var failed int
+		for _, m := range p.Data {
+			if strings.HasPrefix(m.Key, "prometheus.missing") {
+				failed++
+				continue
+			}
+			last[m.Key] = m.Value
+		}
+		sent = append(sent, len(p.Data))
+		return fmt.Sprintf("processed: %d; failed: %d; total: %d; seconds spent: 0.000041", len(p.Data)-failed, failed, len(p.Data))
+	})
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:         s,
+		KeyPrefix:      "prometheus",
+		DefaultHost:    "host",
+		Encoding:       itemvalue.Severity,
+		BisectRejected: true,
+	}
+
+	// InstanceDown of both halves shares the item, the left half has the failed metric
+	code, res := post(t, h, `{
+		"status": "firing",
+		"receiver": "testing",
+		"commonLabels": {"alertname": "InstanceDown"},
+		"alerts": [
+			{"labels": {"alertname": "MissingItem"}},
+			{"labels": {"alertname": "InstanceDown", "severity": "warning"}},
+			{"labels": {"alertname": "DiskFull"}},
+			{"labels": {"alertname": "InstanceDown", "severity": "critical"}}
+		]
+	}`)
+	if code != http.StatusOK || len(res.Rejected) != 1 {
+		t.Fatalf("Expected the missing item to be rejected, got %d %+v", code, res)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// [missingitem instancedown] is split, the accepted right half is sent again after it
+	if fmt.Sprint(sent) != "[4 2 1 2]" {
+		t.Fatalf("Unexpected packet sizes: %v", sent)
+	}
+	if last["prometheus.instancedown"] != "5" {
+		t.Fatalf("Expected the last value to be stored last, got %v", last)
+	}
+}
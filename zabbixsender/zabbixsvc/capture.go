@@ -0,0 +1,243 @@
+package zabbixsvc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// redactedHeaders are never written to the capture file.
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// CaptureRecord is a single received request written to the capture file.
+type CaptureRecord struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	Headers   http.Header     `json:"headers"`
+	Body      json.RawMessage `json:"body"`
+	Outcome   CaptureOutcome  `json:"outcome"`
+}
+
+// CaptureOutcome is the response zal returned for a captured request.
+type CaptureOutcome struct {
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+// Capture writes received requests to a JSONL file, rotating it when it grows over MaxSize.
+type Capture struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewCapture opens capture file for appending.
+// Rotated files are named path.1 ... path.maxFiles, maxSize <= 0 disables rotation.
+func NewCapture(path string, maxSize int64, maxFiles int) (*Capture, error) {
+	c := &Capture{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Capture) open() error {
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "can't open the capture file: %s", c.path)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "can't stat the capture file: %s", c.path)
+	}
+
+	c.f = f
+	c.size = fi.Size()
+	return nil
+}
+
+// rotate renames the capture file and opens a new one. The file stays closed when rotation fails,
+// Write opens it again.
+func (c *Capture) rotate() error {
+	err := c.f.Close()
+	c.f = nil
+	if err != nil {
+		return errors.Wrapf(err, "can't close the capture file: %s", c.path)
+	}
+
+	for i := c.maxFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", c.path, i), fmt.Sprintf("%s.%d", c.path, i+1))
+	}
+
+	if c.maxFiles > 0 {
+		if err := os.Rename(c.path, c.path+".1"); err != nil {
+			return errors.Wrapf(err, "can't rotate the capture file: %s", c.path)
+		}
+	} else if err := os.Remove(c.path); err != nil {
+		return errors.Wrapf(err, "can't remove the capture file: %s", c.path)
+	}
+
+	return c.open()
+}
+
+// Write appends record to the capture file.
+func (c *Capture) Write(rec *CaptureRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal capture record")
+	}
+	b = append(b, '\n')
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.maxSize > 0 && c.size > 0 && c.size+int64(len(b)) > c.maxSize {
+		if err := c.rotate(); err != nil {
+			// the record is appended to the current file, rotation is tried again by the next write
+			log.Errorf("error rotating capture file: %v", err)
+		}
+	}
+
+	if c.f == nil {
+		if err := c.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := c.f.Write(b)
+	c.size += int64(n)
+	if err != nil {
+		return errors.Wrapf(err, "can't write to the capture file: %s", c.path)
+	}
+
+	return nil
+}
+
+// Close closes the capture file.
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return nil
+	}
+	return c.f.Close()
+}
+
+// Wrap records every request handled by next together with its outcome.
+func (c *Capture) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			log.Errorf("error reading request body: %v", err)
+			http.Error(w, "can't read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		rec := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(rec, r)
+
+		headers := r.Header.Clone()
+		for _, h := range redactedHeaders {
+			headers.Del(h)
+		}
+
+		if !json.Valid(body) {
+			// Keep invalid payloads as a JSON string, so that the record stays valid JSON.
+			body, _ = json.Marshal(string(body))
+		}
+
+		record := &CaptureRecord{
+			Timestamp: time.Now(),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Headers:   headers,
+			Body:      body,
+			Outcome: CaptureOutcome{
+				Code: rec.code,
+			},
+		}
+		if rec.code >= http.StatusBadRequest {
+			record.Outcome.Error = strings.TrimSpace(rec.body.String())
+		}
+
+		if err := c.Write(record); err != nil {
+			log.Errorf("error capturing request: %v", err)
+		}
+	}
+}
+
+// responseRecorder remembers the status code and error body written by a handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	code        int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.code = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	if r.code >= http.StatusBadRequest {
+		r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// ReadCapture calls fn for every record in a capture file.
+func ReadCapture(r io.Reader, fn func(line int, rec *CaptureRecord) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var rec CaptureRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return errors.Wrapf(err, "can't decode capture record, line: %d", line)
+		}
+
+		if err := fn(line, &rec); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(scanner.Err(), "can't read capture file")
+}
@@ -0,0 +1,254 @@
+package zabbixsvc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+func TestCaptureWrap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	c, err := zabbixsvc.NewCapture(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	h := &zabbixsvc.JSONHandler{DefaultHost: "host"}
+	handler := c.Wrap(h.HandlePost)
+
+	for _, body := range []string{alertMissingFields, alertBadReqErr} {
+		req := httptest.NewRequest("POST", "/alerts", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("User-Agent", "Alertmanager/0.21.0")
+		handler(httptest.NewRecorder(), req)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []*zabbixsvc.CaptureRecord
+	err = zabbixsvc.ReadCapture(f, func(line int, rec *zabbixsvc.CaptureRecord) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+
+	rec := records[0]
+	if rec.Outcome.Code != http.StatusBadRequest || rec.Outcome.Error != "missing fields in request body" {
+		t.Fatalf("Unexpected outcome: %+v", rec.Outcome)
+	}
+	if rec.Headers.Get("Authorization") != "" || rec.Headers.Get("User-Agent") != "Alertmanager/0.21.0" {
+		t.Fatalf("Unexpected headers: %v", rec.Headers)
+	}
+	if rec.Path != "/alerts" || rec.Method != "POST" {
+		t.Fatalf("Unexpected request: %s %s", rec.Method, rec.Path)
+	}
+
+	var body string
+	if err := json.Unmarshal(records[1].Body, &body); err != nil || body != alertBadReqErr {
+		t.Fatalf("Expected invalid body to be kept as string, got %s", records[1].Body)
+	}
+}
+
+func TestCaptureRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	c, err := zabbixsvc.NewCapture(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 4; i++ {
+		if err := c.Write(&zabbixsvc.CaptureRecord{Body: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected %s.3 to be removed, got %v", path, err)
+	}
+}
+
+func TestCaptureRotateFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	// the capture file can't be renamed to a directory which isn't empty
+	if err := os.MkdirAll(filepath.Join(path+".1", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := zabbixsvc.NewCapture(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := c.Write(&zabbixsvc.CaptureRecord{Body: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("Expected records to be written when rotation fails: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	records := 0
+	if err := zabbixsvc.ReadCapture(f, func(int, *zabbixsvc.CaptureRecord) error { records++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if records != 3 {
+		t.Fatalf("Expected 3 records, got %d", records)
+	}
+}
+
+// writeCapture writes records of the bodies received on paths and answered with codes to a capture file.
+func writeCapture(t *testing.T, records []zabbixsvc.CaptureRecord) string {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	c, err := zabbixsvc.NewCapture(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for _, rec := range records {
+		if !json.Valid(rec.Body) {
+			rec.Body, _ = json.Marshal(string(rec.Body))
+		}
+		if err := c.Write(&rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestReplayDryRun(t *testing.T) {
+	ok := zabbixsvc.CaptureOutcome{Code: http.StatusOK}
+	pulled := strings.Replace(alertInternal, `"alertname":"InstanceDown",`, `"alertname":"InstanceDown","zal_source":"zabbix",`, -1)
+
+	path := writeCapture(t, []zabbixsvc.CaptureRecord{
+		{Path: "/alerts", Body: []byte(alertInternal), Outcome: ok},
+		{Path: "/alerts", Body: []byte(alertBadReqErr), Outcome: zabbixsvc.CaptureOutcome{Code: http.StatusBadRequest}},
+		// failed requests are retried by Alertmanager
+		{Path: "/alerts", Body: []byte(alertInternal), Outcome: zabbixsvc.CaptureOutcome{Code: http.StatusInternalServerError}},
+		{Path: "/alerts", Body: []byte(pulled), Outcome: ok},
+		{Path: "/alerts/web1", Body: []byte(alertInternal), Outcome: ok},
+		{Path: "/alerts/web1", Body: []byte(alertInternal), Outcome: zabbixsvc.CaptureOutcome{Code: http.StatusForbidden}},
+		// the host is no longer allowed in the path
+		{Path: "/alerts/db1", Body: []byte(alertInternal), Outcome: ok},
+		{Path: "/webhooks/backup", Body: []byte(webhookPayload), Outcome: ok},
+		{Path: "/webhooks/unknown", Body: []byte(webhookPayload), Outcome: ok},
+		{Path: "/alerts", Body: []byte(alertOK), Outcome: ok},
+	})
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h := &zabbixsvc.JSONHandler{
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		Hosts:       map[string]string{"testing": "replayed"},
+	}
+
+	wh, err := zabbixsvc.NewWebhook(h, zabbixsvc.WebhookConfig{
+		Path:         "/webhooks/backup",
+		Alerts:       "data.events",
+		AlertName:    "{{ .check }}",
+		Status:       "{{ .state }}",
+		FiringValues: []string{"PROBLEM"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pathRouting, err := zabbixsvc.NewPathRouting(h, zabbixsvc.PathRoutingConfig{Hosts: []string{"web1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := h.Replay(f, &out, true, zabbixsvc.ReplaySources{Webhooks: []*zabbixsvc.Webhook{wh}, PathRouting: pathRouting}); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := json.NewDecoder(&out)
+	var values []string
+	for dec.More() {
+		var m zabbixsnd.Metric
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, m.Host+" "+m.Key+"="+m.Value)
+	}
+
+	expected := "replayed prometheus.instancedown=1,web1 prometheus.instancedown=1,host prometheus.backupfailed=1,host prometheus.backupslow=0,replayed prometheus.instancedown=0"
+	if strings.Join(values, ",") != expected {
+		t.Fatalf("Expected metrics %s, got %v", expected, values)
+	}
+}
+
+func TestReplaySend(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	var body bytes.Buffer
+	if err := json.Compact(&body, []byte(alertInternal)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	if err := ioutil.WriteFile(path, []byte(`{"path":"/alerts","body":`+body.String()+`,"outcome":{"code":200}}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+	}
+	if err := h.Replay(f, ioutil.Discard, false, zabbixsvc.ReplaySources{}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := <-packets
+	if len(p.Data) != 1 || p.Data[0].Key != "prometheus.instancedown" || p.Data[0].Value != "1" {
+		t.Fatalf("Unexpected packet: %+v", p.Data)
+	}
+}
@@ -0,0 +1,103 @@
+package zabbixsvc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var duplicateNotificationsTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "alerts_duplicate_notifications_total",
+		Help: "Number of Alertmanager notifications not sent to Zabbix again, as they were received within the dedupe window",
+	},
+	[]string{"receiver"},
+)
+
+// Dedupe drops Alertmanager notifications received again within the window, e.g. from every member of
+// an Alertmanager cluster or by retries of notifications which were already sent. Notifications are the
+// same when their group key, status and alert fingerprints and timestamps are the same.
+type Dedupe struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	purged time.Time
+}
+
+// NewDedupe creates Dedupe remembering notifications for the window.
+func NewDedupe(window time.Duration) *Dedupe {
+	return &Dedupe{
+		window: window,
+		seen:   map[string]time.Time{},
+	}
+}
+
+// add remembers the notification and reports whether it wasn't seen within the window. Notifications
+// without a group key, i.e. not sent by Alertmanager or Grafana, are never duplicates. The returned key is passed
+// to forget when the notification fails, so its retry is sent.
+func (d *Dedupe) add(n *Notification) (string, bool) {
+	if d == nil || n.GroupKey == "" {
+		return "", true
+	}
+
+	key := dedupeKey(n)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// expired notifications are dropped at most once a window
+	if now.Sub(d.purged) >= d.window {
+		for k, t := range d.seen {
+			if now.Sub(t) >= d.window {
+				delete(d.seen, k)
+			}
+		}
+		d.purged = now
+	}
+
+	if t, ok := d.seen[key]; ok && now.Sub(t) < d.window {
+		return key, false
+	}
+
+	d.seen[key] = now
+	return key, true
+}
+
+// forget drops the notification of the key, empty key is ignored.
+func (d *Dedupe) forget(key string) {
+	if d == nil || key == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, key)
+}
+
+// dedupeKey hashes the routing, group key, status and alerts of the notification.
+// Fingerprints of alerts sent by older Alertmanager versions are computed from their labels.
+func dedupeKey(n *Notification) string {
+	alerts := make([]string, len(n.Alerts))
+	for i, alert := range n.Alerts {
+		id := alert.Fingerprint
+		if id == "" {
+			id = fingerprint(alert.Labels).String()
+		}
+		alerts[i] = id + "\x00" + alert.StartsAt + "\x00" + alert.EndsAt
+	}
+	sort.Strings(alerts)
+
+	h := sha256.New()
+	for _, s := range append([]string{n.Receiver, n.Host, n.KeyPrefix, n.GroupKey, n.Status}, alerts...) {
+		h.Write([]byte(s))
+		h.Write([]byte{0xff})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,72 @@
+package zabbixsvc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+// post sends the Alertmanager request to the handler and returns the status code and result.
+func post(t *testing.T, h *zabbixsvc.JSONHandler, body string) (int, zabbixsvc.SendResult) {
+	rr := httptest.NewRecorder()
+	h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(body)))
+
+	var res zabbixsvc.SendResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return rr.Code, res
+}
+
+func TestDedupe(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		Dedupe:      zabbixsvc.NewDedupe(100 * time.Millisecond),
+	}
+
+	if code, res := post(t, h, alertInternal); code != http.StatusOK || res.Status != "success" {
+		t.Fatalf("Expected notification to be sent, got %d %+v", code, res)
+	}
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+
+	if code, res := post(t, h, alertInternal); code != http.StatusOK || res.Status != "duplicate" {
+		t.Fatalf("Expected duplicate notification, got %d %+v", code, res)
+	}
+	expectPacket(t, packets, nil)
+
+	// the status is a part of the notification
+	post(t, h, strings.Replace(alertInternal, `"status":"firing"`, `"status":"resolved"`, 1))
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "0"})
+
+	time.Sleep(100 * time.Millisecond)
+	post(t, h, alertInternal)
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+}
+
+func TestDedupeFailed(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 0; failed: 1; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		Dedupe:      zabbixsvc.NewDedupe(time.Hour),
+	}
+
+	// retries of failed notifications are sent again
+	for i := 0; i < 2; i++ {
+		if code, _ := post(t, h, alertInternal); code != http.StatusInternalServerError {
+			t.Fatalf("Expected failed send, got %d", code)
+		}
+		expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+	}
+}
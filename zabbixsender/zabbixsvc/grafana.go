@@ -0,0 +1,133 @@
+package zabbixsvc
+
+import (
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GrafanaRequest is webhook request received from Grafana unified alerting.
+type GrafanaRequest struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	State             string            `json:"state"`
+	Receiver          string            `json:"receiver"`
+	OrgID             int64             `json:"orgId"`
+	Title             string            `json:"title"`
+	Message           string            `json:"message"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []GrafanaAlert    `json:"alerts"`
+}
+
+// GrafanaAlert is alert received from Grafana, unlike Alertmanager each alert has its own status.
+type GrafanaAlert struct {
+	Status       string             `json:"status"`
+	Labels       map[string]string  `json:"labels"`
+	Annotations  map[string]string  `json:"annotations"`
+	StartsAt     string             `json:"startsAt,omitempty"`
+	EndsAt       string             `json:"endsAt,omitempty"`
+	Values       map[string]float64 `json:"values"`
+	ValueString  string             `json:"valueString"`
+	GeneratorURL string             `json:"generatorURL"`
+	Fingerprint  string             `json:"fingerprint"`
+	SilenceURL   string             `json:"silenceURL"`
+	DashboardURL string             `json:"dashboardURL"`
+	PanelURL     string             `json:"panelURL"`
+}
+
+// HandleGrafana handles webhook requests from Grafana unified alerting.
+func (h *JSONHandler) HandleGrafana(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r, "HandleGrafana")
+	defer span.End()
+	defer r.Body.Close()
+
+	var req GrafanaRequest
+	if err := decode(ctx, r.Body, &req); err != nil {
+		alertsErrorsTotal.WithLabelValues("", "").Inc()
+
+		log.Errorf("error decoding grafana message: %v", err)
+		http.Error(w, "request body is not valid json", http.StatusBadRequest)
+		return
+	}
+
+	if !req.valid() {
+		alertsErrorsTotal.WithLabelValues(req.Status, req.Receiver).Inc()
+		http.Error(w, "missing fields in request body", http.StatusBadRequest)
+		return
+	}
+
+	log.Debugf("received grafana notification, orgId: %d, receiver: %s, title: %s", req.OrgID, req.Receiver, req.Title)
+
+	h.handleNotification(ctx, w, req.notification())
+}
+
+func (req *GrafanaRequest) valid() bool {
+	if req.Status == "" || len(req.Alerts) == 0 {
+		return false
+	}
+
+	for _, alert := range req.Alerts {
+		if alert.Status == "" || alert.Labels["alertname"] == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GrafanaValueAnnotation is the annotation of the value of Grafana alerts with a single value, so it can be
+// forwarded as the sample value. Each value is also added as GrafanaValueAnnotation_{refId} annotation.
+const GrafanaValueAnnotation = "value"
+
+// notification keeps the status of each alert. Grafana specific fields and values are added to alert annotations.
+func (req *GrafanaRequest) notification() *Notification {
+	alerts := make([]Alert, len(req.Alerts))
+	for i, a := range req.Alerts {
+		annotations := make(map[string]string, len(a.Annotations)+len(a.Values)+7)
+		for refID, v := range a.Values {
+			annotations[GrafanaValueAnnotation+"_"+refID] = strconv.FormatFloat(v, 'f', -1, 64)
+			if len(a.Values) == 1 {
+				annotations[GrafanaValueAnnotation] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+		// annotations of the alert rule take precedence
+		for k, v := range a.Annotations {
+			annotations[k] = v
+		}
+
+		for k, v := range map[string]string{
+			"orgId":        strconv.FormatInt(req.OrgID, 10),
+			"valueString":  a.ValueString,
+			"generatorURL": a.GeneratorURL,
+			"silenceURL":   a.SilenceURL,
+			"dashboardURL": a.DashboardURL,
+			"panelURL":     a.PanelURL,
+		} {
+			if v != "" {
+				annotations[k] = v
+			}
+		}
+
+		alerts[i] = Alert{
+			Status:      a.Status,
+			Fingerprint: a.Fingerprint,
+			Labels:      a.Labels,
+			Annotations: annotations,
+			StartsAt:    a.StartsAt,
+			EndsAt:      a.EndsAt,
+		}
+	}
+
+	return &Notification{
+		Receiver: req.Receiver,
+		Status:   req.Status,
+		Alerts:   alerts,
+		GroupKey: req.GroupKey,
+	}
+}
@@ -0,0 +1,133 @@
+package zabbixsvc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+const grafanaAlert = `{
+	"receiver": "grafana",
+	"status": "firing",
+	"orgId": 1,
+	"alerts": [
+		{
+			"status": "firing",
+			"labels": {"alertname": "HighCPU", "instance": "node1"},
+			"annotations": {"summary": "CPU is high"},
+			"startsAt": "2022-01-01T00:00:00Z",
+			"endsAt": "0001-01-01T00:00:00Z",
+			"generatorURL": "http://grafana/alerting/grafana/abc/view",
+			"fingerprint": "57c6d9296de2ad39",
+			"silenceURL": "http://grafana/alerting/silence/new",
+			"dashboardURL": "http://grafana/d/abc",
+			"panelURL": "http://grafana/d/abc?viewPanel=1",
+			"values": {"B": 95.5},
+			"valueString": "[ var='B' labels={instance=node1} value=95.5 ]"
+		},
+		{
+			"status": "resolved",
+			"labels": {"alertname": "DiskFull", "instance": "node1"},
+			"annotations": {},
+			"startsAt": "2022-01-01T00:00:00Z",
+			"endsAt": "2022-01-01T00:05:00Z"
+		}
+	],
+	"groupLabels": {},
+	"commonLabels": {"instance": "node1"},
+	"commonAnnotations": {},
+	"externalURL": "http://grafana/",
+	"version": "1",
+	"groupKey": "{}:{}",
+	"truncatedAlerts": 0,
+	"title": "[FIRING:1, RESOLVED:1]",
+	"state": "alerting",
+	"message": "**Firing**"
+}`
+
+func TestHandleGrafana(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 2; failed: 0; total: 2; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Hosts:       map[string]string{"grafana": "grafana-host"},
+	}
+
+	rr := httptest.NewRecorder()
+	h.HandleGrafana(rr, httptest.NewRequest("POST", "/grafana", strings.NewReader(grafanaAlert)))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code, rr.Body.String())
+	}
+
+	p := <-packets
+	if len(p.Data) != 2 {
+		t.Fatalf("Expected 2 metrics, got %d", len(p.Data))
+	}
+
+	expected := map[string]string{
+		"prometheus.highcpu":  "1",
+		"prometheus.diskfull": "0",
+	}
+	for _, m := range p.Data {
+		if m.Host != "grafana-host" {
+			t.Errorf("Expected host grafana-host, got %s", m.Host)
+		}
+		if expected[m.Key] != m.Value {
+			t.Errorf("Unexpected value for %s: %s", m.Key, m.Value)
+		}
+	}
+}
+
+func TestHandleGrafanaMissingFields(t *testing.T) {
+	h := &zabbixsvc.JSONHandler{DefaultHost: "default"}
+
+	for _, body := range []string{
+		`{"status": "firing", "alerts": []}`,
+		`{"status": "firing", "alerts": [{"status": "firing", "labels": {}}]}`,
+		`{"status": "firing", "alerts": [{"labels": {"alertname": "A"}}]}`,
+		`{"status": firing}`,
+	} {
+		rr := httptest.NewRecorder()
+		h.HandleGrafana(rr, httptest.NewRequest("POST", "/grafana", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected bad request for %s, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestHandleGrafanaSamples(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 3; failed: 0; total: 3; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Samples:     itemvalue.SampleConfig{Annotation: "value", KeySuffix: "value"},
+		Dedupe:      zabbixsvc.NewDedupe(time.Minute),
+	}
+
+	rr := httptest.NewRecorder()
+	h.HandleGrafana(rr, httptest.NewRequest("POST", "/grafana", strings.NewReader(grafanaAlert)))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code, rr.Body.String())
+	}
+	expectPacket(t, packets, map[string]string{
+		"prometheus.highcpu":       "1",
+		"prometheus.highcpu.value": "95.5",
+		"prometheus.diskfull":      "0",
+	})
+
+	rr = httptest.NewRecorder()
+	h.HandleGrafana(rr, httptest.NewRequest("POST", "/grafana", strings.NewReader(grafanaAlert)))
+	if !strings.Contains(rr.Body.String(), `"status":"duplicate"`) {
+		t.Fatalf("Expected duplicate notification, got %s", rr.Body.String())
+	}
+	expectPacket(t, packets, nil)
+}
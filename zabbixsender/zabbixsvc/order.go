@@ -0,0 +1,193 @@
+package zabbixsvc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+// orderRetention is the time values of alerts are remembered, older notifications are not expected.
+const orderRetention = 24 * time.Hour
+
+var staleValuesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "alerts_stale_values_total",
+		Help: "Number of alert values not sent to Zabbix, as a newer value of the same alert was sent before",
+	},
+	[]string{"host", "key"},
+)
+
+// Order keeps values of the same Zabbix item in order. Sends of the same host and key wait for each other,
+// and values of alerts older than the value of the alert sent before are dropped, e.g. a firing notification
+// received after the notification resolving it. Values are ordered by the start of firing alerts and the
+// end of resolved alerts, values of the alerts api by the time they were received.
+type Order struct {
+	mu     sync.Mutex
+	locks  map[string]*keyLock
+	last   map[string]time.Time
+	purged time.Time
+}
+
+// keyLock serialises sends of a host and key, it is dropped when no send holds it.
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewOrder creates Order without any sent values.
+func NewOrder() *Order {
+	return &Order{
+		locks:  map[string]*keyLock{},
+		last:   map[string]time.Time{},
+		purged: time.Now(),
+	}
+}
+
+// lock waits until no other send holds hosts and keys of the metrics and returns the function releasing them.
+// Keys are locked in order, so sends of overlapping keys don't deadlock.
+func (o *Order) lock(metrics []*zabbixsnd.Metric) func() {
+	if o == nil {
+		return func() {}
+	}
+
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range metrics {
+		k := m.Host + "\x00" + m.Key
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	locks := make([]*keyLock, len(keys))
+	o.mu.Lock()
+	for i, k := range keys {
+		l, ok := o.locks[k]
+		if !ok {
+			l = &keyLock{}
+			o.locks[k] = l
+		}
+		l.refs++
+		locks[i] = l
+	}
+	o.mu.Unlock()
+
+	for _, l := range locks {
+		l.Lock()
+	}
+
+	return func() {
+		for _, l := range locks {
+			l.Unlock()
+		}
+
+		o.mu.Lock()
+		for i, k := range keys {
+			if locks[i].refs--; locks[i].refs == 0 {
+				delete(o.locks, k)
+			}
+		}
+		o.mu.Unlock()
+	}
+}
+
+// fresh drops metrics of alerts older than the values sent before. Alerts of the returned notification
+// are the alerts of the returned metrics.
+func (o *Order) fresh(n *Notification, metrics []*zabbixsnd.Metric) (*Notification, []*zabbixsnd.Metric) {
+	if o == nil {
+		return n, metrics
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var alerts []Alert
+	var fresh []*zabbixsnd.Metric
+	for i, m := range metrics {
+		alert := n.Alerts[i]
+		if t, ok := alertTime(alert); ok && t.Before(o.last[orderKey(m, alert)]) {
+			staleValuesTotal.WithLabelValues(m.Host, m.Key).Inc()
+			log.Warnf("not sending stale alert value, a newer value was sent before, host: '%s' key: '%s', value: '%s'", m.Host, m.Key, m.Value)
+			continue
+		}
+		alerts = append(alerts, alert)
+		fresh = append(fresh, m)
+	}
+
+	if len(fresh) == len(metrics) {
+		return n, metrics
+	}
+
+	res := *n
+	res.Alerts = alerts
+	return &res, fresh
+}
+
+// record remembers times of the alerts of metrics sent to Zabbix, metrics rejected by Zabbix are skipped.
+func (o *Order) record(n *Notification, metrics []*zabbixsnd.Metric, res *ZabbixResponse) {
+	if o == nil {
+		return
+	}
+
+	rejected := map[*zabbixsnd.Metric]bool{}
+	for _, m := range res.Rejected {
+		rejected[m] = true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(o.purged) >= time.Hour {
+		for k, t := range o.last {
+			if now.Sub(t) >= orderRetention {
+				delete(o.last, k)
+			}
+		}
+		o.purged = now
+	}
+
+	for i, m := range metrics {
+		t, ok := alertTime(n.Alerts[i])
+		if !ok || rejected[m] {
+			continue
+		}
+		if k := orderKey(m, n.Alerts[i]); t.After(o.last[k]) {
+			o.last[k] = t
+		}
+	}
+}
+
+// orderKey identifies the alert of the metric, alerts of the same alertname share the item.
+func orderKey(m *zabbixsnd.Metric, alert Alert) string {
+	id := alert.Fingerprint
+	if id == "" {
+		id = fingerprint(alert.Labels).String()
+	}
+	return m.Host + "\x00" + m.Key + "\x00" + id
+}
+
+// alertTime returns the start of firing and the end of resolved alerts, it is false when the time is unknown.
+func alertTime(alert Alert) (time.Time, bool) {
+	if !alert.receivedAt.IsZero() {
+		return alert.receivedAt, true
+	}
+
+	ts := alert.StartsAt
+	if alert.Status != "firing" {
+		ts = alert.EndsAt
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil || t.IsZero() {
+		return time.Time{}, false
+	}
+	return t, true
+}
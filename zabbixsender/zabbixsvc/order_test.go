@@ -0,0 +1,71 @@
+package zabbixsvc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+// alertResolved resolves alertInternal at its EndsAt, after it started.
+var alertResolved = strings.Replace(alertInternal, `"status":"firing"`, `"status":"resolved"`, 1)
+
+func TestOrderDropsStaleValues(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		Order:       zabbixsvc.NewOrder(),
+	}
+
+	post(t, h, alertResolved)
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "0"})
+
+	// the firing notification of the resolved alert arrived late
+	if code, res := post(t, h, alertInternal); code != http.StatusOK || len(res.Metrics) != 0 {
+		t.Fatalf("Expected stale value not to be sent, got %d %+v", code, res)
+	}
+	expectPacket(t, packets, nil)
+
+	// the alert fires again
+	post(t, h, strings.Replace(alertInternal, "2018-08-30T16:59:09", "2018-08-30T17:05:09", 1))
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+
+	// other instances of the alert share the item, but not the order
+	post(t, h, strings.Replace(alertInternal, `"instance":"localhost:9100",
+				 "job"`, `"instance":"localhost:9200",
+				 "job"`, 1))
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+}
+
+func TestOrderConcurrent(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		h := &zabbixsvc.JSONHandler{
+			KeyPrefix:   "prometheus",
+			DefaultHost: "host",
+			State:       zabbixsvc.NewState(),
+			DryRun:      true,
+			Order:       zabbixsvc.NewOrder(),
+		}
+
+		var wg sync.WaitGroup
+		for _, body := range []string{alertInternal, alertResolved, alertInternal, alertInternal} {
+			wg.Add(1)
+			go func(body string) {
+				defer wg.Done()
+				h.HandlePost(httptest.NewRecorder(), httptest.NewRequest("POST", "/alerts", strings.NewReader(body)))
+			}(body)
+		}
+		wg.Wait()
+
+		// the firing notification is never sent after the resolved one
+		if entries := h.State.List("host", ""); len(entries) != 1 || entries[0].Value != "0" {
+			t.Fatalf("Expected resolved value to be the last one, got %+v", entries)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package zabbixsvc
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// PathRoutingPath is the path prefix of Alertmanager requests with the Zabbix host in the path,
+// /alerts/{host} or /alerts/{host}/{keyPrefix}.
+const PathRoutingPath = "/alerts/"
+
+var keyPrefixRegexp = regexp.MustCompile(`^[0-9A-Za-z_.-]+$`)
+
+// PathRoutingConfig allows Zabbix hosts to be set in the path of Alertmanager webhook urls.
+// Path routing is disabled unless hosts or pattern are set.
+type PathRoutingConfig struct {
+	// Hosts are allowed in the path.
+	Hosts []string `yaml:"hosts"`
+	// Pattern is a regular expression matching whole host names allowed in the path.
+	Pattern string `yaml:"pattern"`
+}
+
+// Enabled reports whether any host is allowed in the path.
+func (cfg PathRoutingConfig) Enabled() bool {
+	return len(cfg.Hosts) != 0 || cfg.Pattern != ""
+}
+
+// Validate checks that the pattern can be parsed.
+func (cfg PathRoutingConfig) Validate() error {
+	_, err := NewPathRouting(nil, cfg)
+	return err
+}
+
+// PathRouting handles Alertmanager requests sent to /alerts/{host} and /alerts/{host}/{keyPrefix},
+// so receivers don't need to be listed in the hosts mapping.
+type PathRouting struct {
+	Handler *JSONHandler
+
+	hosts   map[string]struct{}
+	pattern *regexp.Regexp
+}
+
+// NewPathRouting creates PathRouting sending alerts through h.
+func NewPathRouting(h *JSONHandler, cfg PathRoutingConfig) (*PathRouting, error) {
+	p := &PathRouting{Handler: h, hosts: make(map[string]struct{}, len(cfg.Hosts))}
+	for i, host := range cfg.Hosts {
+		if host == "" {
+			return nil, errors.Errorf("hosts[%d]: must not be empty", i)
+		}
+		p.hosts[host] = struct{}{}
+	}
+
+	if cfg.Pattern != "" {
+		var err error
+		if p.pattern, err = regexp.Compile("^(?:" + cfg.Pattern + ")$"); err != nil {
+			return nil, errors.Wrap(err, "pattern")
+		}
+	}
+
+	return p, nil
+}
+
+// allowed reports whether the host is in the allowlist or matches the pattern.
+func (p *PathRouting) allowed(host string) bool {
+	if _, ok := p.hosts[host]; ok {
+		return true
+	}
+	return p.pattern != nil && p.pattern.MatchString(host)
+}
+
+// parseAlertsPath returns the host and the optional key prefix of /alerts/{host}/{keyPrefix} path.
+func parseAlertsPath(path string) (host, keyPrefix string, ok bool) {
+	if !strings.HasPrefix(path, PathRoutingPath) {
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, PathRoutingPath), "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return parts[0], "", true
+	case len(parts) == 2 && parts[0] != "" && keyPrefixRegexp.MatchString(parts[1]):
+		return parts[0], parts[1], true
+	}
+
+	return "", "", false
+}
+
+// HandlePost handles Alertmanager requests, alerts are sent to the host of the path instead of
+// the host of the receiver.
+func (p *PathRouting) HandlePost(w http.ResponseWriter, r *http.Request) {
+	host, keyPrefix, ok := parseAlertsPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !p.allowed(host) {
+		alertsErrorsTotal.WithLabelValues("", "").Inc()
+		log.Warnf("rejected alerts for host not allowed in path: %s", host)
+		http.Error(w, "host is not allowed", http.StatusForbidden)
+		return
+	}
+
+	ctx, span := startSpan(r, "PathRouting.HandlePost")
+	defer span.End()
+	defer r.Body.Close()
+
+	var req AlertmanagerRequest
+	if err := decode(ctx, r.Body, &req); err != nil {
+		alertsErrorsTotal.WithLabelValues("", host).Inc()
+
+		log.Errorf("error decoding message: %v", err)
+		http.Error(w, "request body is not valid json", http.StatusBadRequest)
+		return
+	}
+
+	if !req.valid() {
+		alertsErrorsTotal.WithLabelValues(req.Status, host).Inc()
+		http.Error(w, "missing fields in request body", http.StatusBadRequest)
+		return
+	}
+
+	n := req.notification()
+	n.Host = host
+	n.KeyPrefix = keyPrefix
+
+	p.Handler.handleNotification(ctx, w, n)
+}
@@ -0,0 +1,65 @@
+package zabbixsvc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+func TestPathRouting(t *testing.T) {
+	h := &zabbixsvc.JSONHandler{
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Hosts:       map[string]string{"testing": "routed"},
+		State:       zabbixsvc.NewState(),
+		DryRun:      true,
+	}
+
+	p, err := zabbixsvc.NewPathRouting(h, zabbixsvc.PathRoutingConfig{
+		Hosts:   []string{"web1"},
+		Pattern: `db-[0-9]+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path string
+		code int
+		host string
+		key  string
+	}{
+		{path: "/alerts/web1", code: http.StatusOK, host: "web1", key: "prometheus.instancedown"},
+		{path: "/alerts/db-1/app", code: http.StatusOK, host: "db-1", key: "app.instancedown"},
+		{path: "/alerts/db-x", code: http.StatusForbidden},
+		{path: "/alerts/routed", code: http.StatusForbidden},
+		{path: "/alerts/web1/a b", code: http.StatusNotFound},
+		{path: "/alerts/web1/app/extra", code: http.StatusNotFound},
+		{path: "/alerts/", code: http.StatusNotFound},
+	} {
+		rr := httptest.NewRecorder()
+		p.HandlePost(rr, httptest.NewRequest("POST", "http://zal"+strings.Replace(tc.path, " ", "%20", -1), strings.NewReader(alertInternal)))
+		if rr.Code != tc.code {
+			t.Errorf("Expected %d for %s, got %d", tc.code, tc.path, rr.Code)
+			continue
+		}
+		if tc.host == "" {
+			continue
+		}
+
+		if entries := h.State.List(tc.host, tc.key); len(entries) != 1 || entries[0].Key != tc.key {
+			t.Errorf("Expected %s to be sent to %s %s, got %+v", tc.path, tc.host, tc.key, entries)
+		}
+	}
+
+	if entries := h.State.List("", ""); len(entries) != 2 {
+		t.Errorf("Expected only allowed hosts to be sent, got %+v", entries)
+	}
+
+	if err := (zabbixsvc.PathRoutingConfig{Pattern: "("}).Validate(); err == nil {
+		t.Error("Expected invalid pattern error")
+	}
+}
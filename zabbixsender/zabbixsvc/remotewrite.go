@@ -0,0 +1,415 @@
+package zabbixsvc
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"text/template"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWritePath is the path Prometheus remote_write sends series to.
+const RemoteWritePath = "/api/v1/write"
+
+var remoteWriteSamplesTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "remote_write_samples_total",
+		Help: "Number of samples received through remote_write by result",
+	},
+	[]string{"result"},
+)
+
+// RemoteWriteConfig maps Prometheus remote_write series to Zabbix trapper items.
+type RemoteWriteConfig struct {
+	// BatchSize is the maximum number of values sent to Zabbix in one packet.
+	BatchSize int `yaml:"batchSize"`
+	// Series are matched in order, samples of series not matching any are dropped.
+	Series []SeriesConfig `yaml:"series"`
+}
+
+// SeriesConfig selects series and maps them to Zabbix host and key.
+type SeriesConfig struct {
+	// Matchers select series, all must match, e.g. `__name__="up"` or `job=~"node.*"`.
+	Matchers []string `yaml:"matchers"`
+	// Host and Key are text/template expressions executed with series labels as dot,
+	// e.g. `{{ .instance }}`. Empty host is the default host.
+	Host string `yaml:"host"`
+	Key  string `yaml:"key"`
+}
+
+// Validate checks that matchers and templates can be parsed.
+func (cfg RemoteWriteConfig) Validate() error {
+	_, err := NewRemoteWrite(nil, cfg)
+	return err
+}
+
+// RemoteWrite receives Prometheus remote_write requests and sends selected samples to Zabbix
+// with their original timestamps.
+type RemoteWrite struct {
+	Handler *JSONHandler
+
+	batchSize int
+	series    []seriesRule
+}
+
+type seriesRule struct {
+	matchers []labelMatcher
+	host     *template.Template
+	key      *template.Template
+}
+
+type labelMatcher struct {
+	name  string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+var matcherRegexp = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*(=~|!~|!=|=)\s*("(?:[^"\\]|\\.)*")\s*$`)
+
+func parseMatcher(s string) (labelMatcher, error) {
+	m := matcherRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return labelMatcher{}, errors.Errorf("invalid matcher %q, expected name=\"value\"", s)
+	}
+
+	value, err := strconv.Unquote(m[3])
+	if err != nil {
+		return labelMatcher{}, errors.Wrapf(err, "invalid matcher %q", s)
+	}
+
+	lm := labelMatcher{name: m[1], op: m[2], value: value}
+	if lm.op == "=~" || lm.op == "!~" {
+		if lm.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+			return labelMatcher{}, errors.Wrapf(err, "invalid matcher %q", s)
+		}
+	}
+
+	return lm, nil
+}
+
+// matches reports whether the label value matches, missing labels have empty values.
+func (m *labelMatcher) matches(labels map[string]string) bool {
+	v := labels[m.name]
+	switch m.op {
+	case "=":
+		return v == m.value
+	case "!=":
+		return v != m.value
+	case "=~":
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+// NewRemoteWrite parses matchers and templates of the remote write config.
+func NewRemoteWrite(h *JSONHandler, cfg RemoteWriteConfig) (*RemoteWrite, error) {
+	if cfg.BatchSize <= 0 {
+		return nil, errors.Errorf("batchSize must be positive, got %d", cfg.BatchSize)
+	}
+
+	rw := &RemoteWrite{Handler: h, batchSize: cfg.BatchSize}
+	for i, s := range cfg.Series {
+		if len(s.Matchers) == 0 || s.Key == "" {
+			return nil, errors.Errorf("series[%d]: matchers and key are required", i)
+		}
+
+		var rule seriesRule
+		for _, text := range s.Matchers {
+			m, err := parseMatcher(text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "series[%d]", i)
+			}
+			rule.matchers = append(rule.matchers, m)
+		}
+
+		var err error
+		if rule.host, err = parseTemplate("host", s.Host); err != nil {
+			return nil, errors.Wrapf(err, "series[%d]", i)
+		}
+		if rule.key, err = parseTemplate("key", s.Key); err != nil {
+			return nil, errors.Wrapf(err, "series[%d]", i)
+		}
+
+		rw.series = append(rw.series, rule)
+	}
+
+	return rw, nil
+}
+
+// HandlePost handles Prometheus remote_write requests. Prometheus retries requests answered with
+// 5xx, so only failures to reach Zabbix are reported as such, while invalid requests get 400.
+// Samples Zabbix rejects would be rejected again, they are counted and the request succeeds.
+func (rw *RemoteWrite) HandlePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, span := startSpan(r, "RemoteWrite.HandlePost")
+	defer span.End()
+	defer r.Body.Close()
+
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		log.Errorf("error decoding remote write request: %v", err)
+		http.Error(w, "request body is not snappy compressed", http.StatusBadRequest)
+		return
+	}
+
+	series, err := decodeWriteRequest(b)
+	if err != nil {
+		log.Errorf("error decoding remote write request: %v", err)
+		http.Error(w, "request body is not a valid write request", http.StatusBadRequest)
+		return
+	}
+
+	metrics := rw.metrics(series)
+	span.SetAttributes(attribute.Int("zal.series", len(series)), attribute.Int("zabbix.keys", len(metrics)))
+	for len(metrics) > 0 {
+		n := rw.batchSize
+		if n > len(metrics) {
+			n = len(metrics)
+		}
+
+		rejected := 0
+		res, err := rw.Handler.zabbixSend(ctx, metrics[:n])
+		if rerr, ok := errors.Cause(err).(*rejectedError); ok {
+			// Zabbix may fail the packet without counting failed values
+			rejected = rerr.failed
+			if rejected == 0 || rejected > n {
+				rejected = n
+			}
+			log.Errorf("zabbix rejected remote write samples: %v", err)
+		} else if err != nil {
+			remoteWriteSamplesTotal.WithLabelValues("failed").Add(float64(len(metrics)))
+			log.Errorf("failed to send remote write samples to server: %v", err)
+			http.Error(w, "failed to send to server", http.StatusInternalServerError)
+			return
+		} else {
+			rejected = len(res.Rejected)
+		}
+		remoteWriteSamplesTotal.WithLabelValues("rejected").Add(float64(rejected))
+		remoteWriteSamplesTotal.WithLabelValues("sent").Add(float64(n - rejected))
+
+		metrics = metrics[n:]
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// metrics maps samples of matched series to Zabbix metrics, NaN values including stale markers are dropped.
+func (rw *RemoteWrite) metrics(series []timeSeries) []*zabbixsnd.Metric {
+	var metrics []*zabbixsnd.Metric
+	for _, s := range series {
+		host, key, ok := rw.itemOf(s.labels)
+		if !ok {
+			remoteWriteSamplesTotal.WithLabelValues("unmatched").Add(float64(len(s.samples)))
+			continue
+		}
+
+		for _, sample := range s.samples {
+			if math.IsNaN(sample.value) {
+				remoteWriteSamplesTotal.WithLabelValues("dropped").Inc()
+				continue
+			}
+
+			metrics = append(metrics, &zabbixsnd.Metric{
+				Host:  host,
+				Key:   key,
+				Value: strconv.FormatFloat(sample.value, 'f', -1, 64),
+				Clock: sample.timestamp / 1000,
+				NS:    sample.timestamp % 1000 * 1e6,
+			})
+		}
+	}
+
+	return metrics
+}
+
+// itemOf returns Zabbix host and key of the first series rule matching the labels.
+func (rw *RemoteWrite) itemOf(labels map[string]string) (string, string, bool) {
+	for _, rule := range rw.series {
+		matched := true
+		for i := range rule.matchers {
+			if !rule.matchers[i].matches(labels) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		var host, key bytes.Buffer
+		if err := rule.host.Execute(&host, labels); err != nil {
+			log.Errorf("error executing host template: %v", err)
+			return "", "", false
+		}
+		if err := rule.key.Execute(&key, labels); err != nil {
+			log.Errorf("error executing key template: %v", err)
+			return "", "", false
+		}
+		if key.Len() == 0 {
+			log.Warnf("empty key of series %v", labels)
+			return "", "", false
+		}
+
+		itemKey := rw.Handler.Keys.SanitizeKey(key.String())
+		if host.Len() == 0 {
+			return rw.Handler.DefaultHost, itemKey, true
+		}
+		return host.String(), itemKey, true
+	}
+
+	return "", "", false
+}
+
+type timeSeries struct {
+	labels  map[string]string
+	samples []sample
+}
+
+type sample struct {
+	value float64
+	// timestamp is in milliseconds.
+	timestamp int64
+}
+
+// decodeWriteRequest decodes prometheus.WriteRequest protobuf message, metadata is skipped.
+// https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto
+func decodeWriteRequest(b []byte) ([]timeSeries, error) {
+	var series []timeSeries
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 || typ != protowire.BytesType {
+			return 0, nil
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+
+		s, err := decodeTimeSeries(v)
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid time series")
+		}
+		series = append(series, s)
+
+		return n, nil
+	})
+
+	return series, err
+}
+
+func decodeTimeSeries(b []byte) (timeSeries, error) {
+	s := timeSeries{labels: map[string]string{}}
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType || num != 1 && num != 2 {
+			return 0, nil
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return n, nil
+		}
+
+		if num == 1 {
+			name, value, err := decodeLabel(v)
+			if err != nil {
+				return 0, errors.Wrap(err, "invalid label")
+			}
+			s.labels[name] = value
+		} else {
+			sample, err := decodeSample(v)
+			if err != nil {
+				return 0, errors.Wrap(err, "invalid sample")
+			}
+			s.samples = append(s.samples, sample)
+		}
+
+		return n, nil
+	})
+
+	return s, err
+}
+
+func decodeLabel(b []byte) (name, value string, err error) {
+	err = decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType || num != 1 && num != 2 {
+			return 0, nil
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if num == 1 {
+			name = string(v)
+		} else {
+			value = string(v)
+		}
+		return n, nil
+	})
+
+	return name, value, err
+}
+
+func decodeSample(b []byte) (sample, error) {
+	var s sample
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			s.value = math.Float64frombits(v)
+			return n, nil
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			s.timestamp = int64(v)
+			return n, nil
+		}
+		return 0, nil
+	})
+
+	return s, err
+}
+
+// decodeMessage calls field for every field of the protobuf message with the field value bytes.
+// field returns the length of the consumed value, or zero to skip the field.
+func decodeMessage(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package zabbixsvc_test
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testSample struct {
+	value     float64
+	timestamp int64
+}
+
+// writeRequest encodes prometheus.WriteRequest with a time series per labels.
+func writeRequest(series map[string][]testSample, labels ...map[string]string) []byte {
+	var req []byte
+	for _, ls := range labels {
+		var ts []byte
+		for name, value := range ls {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		for _, s := range series[ls["__name__"]] {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sample)
+		}
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	// metadata is skipped
+	req = protowire.AppendTag(req, 3, protowire.BytesType)
+	req = protowire.AppendBytes(req, []byte{8, 1})
+
+	return snappy.Encode(nil, req)
+}
+
+func TestRemoteWrite(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 2; failed: 0; total: 2; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+	}
+
+	rw, err := zabbixsvc.NewRemoteWrite(h, zabbixsvc.RemoteWriteConfig{
+		BatchSize: 1,
+		Series: []zabbixsvc.SeriesConfig{
+			{Matchers: []string{`__name__="probe_success"`, `job=~"black.*"`}, Host: "{{ .instance }}", Key: "prometheus.{{ .__name__ }}"},
+			{Matchers: []string{`__name__="up"`, `instance!="skip"`}, Key: "prometheus.up[{{ .instance }}]"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := writeRequest(map[string][]testSample{
+		"probe_success": {{1, 1600000000123}, {math.NaN(), 1600000015000}},
+		"up":            {{0, 1600000000000}},
+		"unmatched":     {{1, 1600000000000}},
+	},
+		map[string]string{"__name__": "probe_success", "job": "blackbox", "instance": "web1"},
+		map[string]string{"__name__": "up", "job": "node", "instance": "node1"},
+		map[string]string{"__name__": "up", "job": "node", "instance": "skip"},
+		map[string]string{"__name__": "unmatched"},
+	)
+
+	rr := httptest.NewRecorder()
+	rw.HandlePost(rr, httptest.NewRequest("POST", zabbixsvc.RemoteWritePath, bytes.NewReader(body)))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected no content, got %d: %s", rr.Code, rr.Body)
+	}
+
+	// every sample is sent in its own batch
+	p := <-packets
+	if len(p.Data) != 1 {
+		t.Fatalf("Expected one metric, got %+v", p.Data)
+	}
+	if m := p.Data[0]; m.Host != "web1" || m.Key != "prometheus.probe_success" || m.Value != "1" || m.Clock != 1600000000 || m.NS != 123000000 {
+		t.Fatalf("Unexpected metric: %+v", m)
+	}
+
+	p = <-packets
+	if len(p.Data) != 1 {
+		t.Fatalf("Expected one metric, got %+v", p.Data)
+	}
+	if m := p.Data[0]; m.Host != "default" || m.Key != "prometheus.up[node1]" || m.Value != "0" || m.Clock != 1600000000 || m.NS != 0 {
+		t.Fatalf("Unexpected metric: %+v", m)
+	}
+
+	select {
+	case p := <-packets:
+		t.Fatalf("Unexpected packet: %+v", p)
+	default:
+	}
+}
+
+func TestRemoteWriteRejected(t *testing.T) {
+	s, packets := fakeZabbixFunc(t, func(p *zabbixsnd.Packet) string {
+		if p.Data[0].Host == "missing" {
+			return "processed: 0; failed: 1; total: 1; seconds spent: 0.000041"
+		}
+		return "processed: 1; failed: 0; total: 1; seconds spent: 0.000041"
+	})
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+	}
+
+	rw, err := zabbixsvc.NewRemoteWrite(h, zabbixsvc.RemoteWriteConfig{
+		BatchSize: 1,
+		Series: []zabbixsvc.SeriesConfig{
+			{Matchers: []string{`__name__="up"`}, Host: "{{ .instance }}", Key: "prometheus.{{ .job }}"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := writeRequest(map[string][]testSample{
+		"up": {{1, 1600000000000}},
+	},
+		map[string]string{"__name__": "up", "job": "Node Exporter", "instance": "missing"},
+		map[string]string{"__name__": "up", "job": "Node Exporter", "instance": "web1"},
+	)
+
+	// rejected samples would be rejected again, so Prometheus must not retry them
+	rr := httptest.NewRecorder()
+	rw.HandlePost(rr, httptest.NewRequest("POST", zabbixsvc.RemoteWritePath, bytes.NewReader(body)))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected no content, got %d: %s", rr.Code, rr.Body)
+	}
+
+	for _, host := range []string{"missing", "web1"} {
+		p := <-packets
+		if m := p.Data[0]; m.Host != host || m.Key != "prometheus.node_exporter" {
+			t.Fatalf("Unexpected metric: %+v", m)
+		}
+	}
+}
+
+func TestRemoteWriteErrors(t *testing.T) {
+	rw, err := zabbixsvc.NewRemoteWrite(&zabbixsvc.JSONHandler{DryRun: true}, zabbixsvc.RemoteWriteConfig{BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range [][]byte{[]byte("not snappy"), snappy.Encode(nil, []byte{0x0a, 0xff})} {
+		rr := httptest.NewRecorder()
+		rw.HandlePost(rr, httptest.NewRequest("POST", zabbixsvc.RemoteWritePath, bytes.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("Expected bad request, got %d", rr.Code)
+		}
+	}
+
+	for _, cfg := range []zabbixsvc.RemoteWriteConfig{
+		{BatchSize: 0},
+		{BatchSize: 1, Series: []zabbixsvc.SeriesConfig{{Matchers: []string{"job=node"}, Key: "a"}}},
+		{BatchSize: 1, Series: []zabbixsvc.SeriesConfig{{Matchers: []string{`job=~"("`}, Key: "a"}}},
+		{BatchSize: 1, Series: []zabbixsvc.SeriesConfig{{Matchers: []string{`job="node"`}}}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", cfg)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package zabbixsvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ReplaySources decode captured requests of configured inputs, like the handlers which received them.
+type ReplaySources struct {
+	// Webhooks decode requests captured on their paths.
+	Webhooks []*Webhook
+	// PathRouting allows hosts of requests captured on /alerts/{host}, nil skips them.
+	PathRouting *PathRouting
+}
+
+// Replay sends Alertmanager, Grafana and webhook requests from a capture file through the same routing and key logic
+// as the handlers which received them. Only requests answered with 2xx are replayed, as rejected requests were not
+// sent to Zabbix and failed ones were retried by their sender.
+// In dry run mode metrics are written to out as JSON lines instead of being sent to Zabbix.
+// Records which can't be decoded or sent are logged and skipped.
+func (h *JSONHandler) Replay(r io.Reader, out io.Writer, dryRun bool, sources ReplaySources) error {
+	enc := json.NewEncoder(out)
+
+	webhooks := make(map[string]*Webhook, len(sources.Webhooks))
+	for _, wh := range sources.Webhooks {
+		webhooks[wh.path] = wh
+	}
+
+	return ReadCapture(r, func(line int, rec *CaptureRecord) error {
+		if rec.Outcome.Code < http.StatusOK || rec.Outcome.Code >= http.StatusMultipleChoices {
+			log.Infof("skipping capture record, line: %d, response code: %d", line, rec.Outcome.Code)
+			return nil
+		}
+
+		n, err := decodeCaptured(rec, webhooks, sources.PathRouting)
+		if err != nil {
+			log.Warnf("skipping capture record, line: %d, %v", line, err)
+			return nil
+		}
+
+		ctx := context.Background()
+		n, _, metrics := h.route(ctx, n)
+		if len(metrics) == 0 {
+			return nil
+		}
+
+		if dryRun {
+			for _, m := range metrics {
+				if err := enc.Encode(m); err != nil {
+					return errors.Wrap(err, "can't write metric")
+				}
+			}
+			return nil
+		}
+
+		res, err := h.zabbixSend(ctx, metrics)
+		if err != nil {
+			log.Errorf("failed to replay capture record, line: %d, metrics: %v, error: %s", line, metrics, err)
+			return nil
+		}
+
+		h.updateState(n, metrics, res)
+
+		log.Infof("replayed capture record, line: %d, captured at: %s, response: %s", line, rec.Timestamp, res.Info)
+		return nil
+	})
+}
+
+// decodeCaptured decodes captured request body according to the path it was received on.
+// Hosts of routed paths are checked against the current path routing allowlist, as they were
+// when the request was received.
+func decodeCaptured(rec *CaptureRecord, webhooks map[string]*Webhook, pathRouting *PathRouting) (*Notification, error) {
+	dec := json.NewDecoder(bytes.NewReader(rec.Body))
+
+	if wh, ok := webhooks[rec.Path]; ok {
+		dec.UseNumber()
+
+		var payload interface{}
+		if err := dec.Decode(&payload); err != nil {
+			return nil, errors.Wrap(err, "error decoding webhook message")
+		}
+		return wh.notification(payload)
+	}
+
+	switch rec.Path {
+	case AlertsAPIPath:
+		return nil, errors.New("alerts pushed by Prometheus depend on tracked state and can't be replayed")
+
+	case "/grafana":
+		var req GrafanaRequest
+		if err := dec.Decode(&req); err != nil {
+			return nil, errors.Wrap(err, "error decoding grafana message")
+		}
+		if !req.valid() {
+			return nil, errors.New("missing fields in request body")
+		}
+		return req.notification(), nil
+	}
+
+	host, keyPrefix, ok := parseAlertsPath(rec.Path)
+	if rec.Path != "/alerts" && !ok {
+		return nil, errors.Errorf("no input of path %q is configured", rec.Path)
+	}
+	if ok && (pathRouting == nil || !pathRouting.allowed(host)) {
+		return nil, errors.Errorf("host %q is not allowed in path %q", host, rec.Path)
+	}
+
+	var req AlertmanagerRequest
+	if err := dec.Decode(&req); err != nil {
+		return nil, errors.Wrap(err, "error decoding message")
+	}
+	if !req.valid() {
+		return nil, errors.New("missing fields in request body")
+	}
+
+	n := req.notification()
+	n.Host, n.KeyPrefix = host, keyPrefix
+	return n, nil
+}
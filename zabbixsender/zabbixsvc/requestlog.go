@@ -0,0 +1,130 @@
+package zabbixsvc
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestRecord is a received notification and the result of sending it.
+type RequestRecord struct {
+	Time time.Time
+	// Path is the path of requests recorded by Wrap, which aren't notifications.
+	Path     string
+	Receiver string
+	Status   string
+	Alerts   int
+	// Code is the status code of the response.
+	Code   int
+	Result *SendResult
+}
+
+// RequestLog keeps the most recent notifications for the status page.
+type RequestLog struct {
+	mu      sync.Mutex
+	records []RequestRecord
+	next    int
+	size    int
+}
+
+// NewRequestLog creates RequestLog keeping size notifications.
+func NewRequestLog(size int) *RequestLog {
+	return &RequestLog{size: size}
+}
+
+// add records the notification.
+func (l *RequestLog) add(n *Notification, code int, result *SendResult) {
+	l.record(RequestRecord{
+		Time:     time.Now(),
+		Receiver: n.Receiver,
+		Status:   n.Status,
+		Alerts:   len(n.Alerts),
+		Code:     code,
+		Result:   result,
+	})
+}
+
+// Wrap records requests of handlers which don't send notifications as they are received, like
+// remote_write and alerts pushed by Prometheus, whose changed keys are recorded when they are sent.
+func (l *RequestLog) Wrap(receiver string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+		next(rec, r)
+
+		record := RequestRecord{Time: time.Now(), Path: r.URL.Path, Receiver: receiver, Code: rec.code}
+		if rec.code >= http.StatusBadRequest {
+			record.Result = &SendResult{Status: "error", Error: strings.TrimSpace(rec.body.String())}
+		}
+		l.record(record)
+	}
+}
+
+// record adds the record, replacing the oldest one when the log is full.
+func (l *RequestLog) record(r RequestRecord) {
+	if l == nil || l.size <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.records) < l.size {
+		l.records = append(l.records, r)
+		return
+	}
+	l.records[l.next] = r
+	l.next = (l.next + 1) % l.size
+}
+
+// List returns the recorded notifications, the newest first.
+func (l *RequestLog) List() []RequestRecord {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := make([]RequestRecord, 0, len(l.records))
+	for i := len(l.records) - 1; i >= 0; i-- {
+		records = append(records, l.records[(l.next+i)%len(l.records)])
+	}
+	return records
+}
+
+// ZabbixHealth reports results of connections to Zabbix.
+type ZabbixHealth struct {
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+	// Failures is the number of failed sends since the last successful one.
+	Failures int
+}
+
+// zabbixHealth tracks results of connections to Zabbix, its zero value is ready to use.
+type zabbixHealth struct {
+	mu     sync.Mutex
+	health ZabbixHealth
+}
+
+// record records a send to Zabbix which failed with err, nil err is a response received from Zabbix.
+func (z *zabbixHealth) record(err error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if err == nil {
+		z.health.LastSuccess = time.Now()
+		z.health.Failures = 0
+		return
+	}
+	z.health.LastFailure = time.Now()
+	z.health.LastError = err.Error()
+	z.health.Failures++
+}
+
+func (z *zabbixHealth) get() ZabbixHealth {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.health
+}
@@ -0,0 +1,111 @@
+package zabbixsvc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StatePath is the path under which the state API is served.
+const StatePath = "/api/v1/state"
+
+// StateEntry is the last value sent to Zabbix for a single host and key.
+type StateEntry struct {
+	Host     string            `json:"host"`
+	Key      string            `json:"key"`
+	Value    string            `json:"value"`
+	Clock    int64             `json:"clock"`
+	Receiver string            `json:"receiver"`
+	Labels   map[string]string `json:"labels"`
+	Result   *ZabbixResponse   `json:"result"`
+}
+
+// State keeps what zal believes is currently set in Zabbix, by host and key.
+type State struct {
+	mu    sync.RWMutex
+	hosts map[string]map[string]StateEntry
+}
+
+// NewState creates empty state.
+func NewState() *State {
+	return &State{
+		hosts: map[string]map[string]StateEntry{},
+	}
+}
+
+// Update records entries, replacing previous entries with the same host and key.
+func (s *State) Update(entries ...StateEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range entries {
+		keys, ok := s.hosts[e.Host]
+		if !ok {
+			keys = map[string]StateEntry{}
+			s.hosts[e.Host] = keys
+		}
+		keys[e.Key] = e
+	}
+}
+
+// List returns entries sorted by host and key.
+// Empty host matches all hosts, keyPrefix filters keys by prefix.
+func (s *State) List(host, keyPrefix string) []StateEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []StateEntry{}
+	for h, keys := range s.hosts {
+		if host != "" && h != host {
+			continue
+		}
+		for k, e := range keys {
+			if strings.HasPrefix(k, keyPrefix) {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Host != entries[j].Host {
+			return entries[i].Host < entries[j].Host
+		}
+		return entries[i].Key < entries[j].Key
+	})
+
+	return entries
+}
+
+// HasHost reports whether anything was sent to the host.
+func (s *State) HasHost(host string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.hosts[host]
+	return ok
+}
+
+// HandleState serves the state as JSON on StatePath and StatePath/{host}.
+// Results can be filtered with "host" and "key" (prefix) query parameters.
+func (s *State) HandleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := r.URL.Query().Get("host")
+	if h := strings.Trim(strings.TrimPrefix(r.URL.Path, StatePath), "/"); h != "" {
+		if !s.HasHost(h) {
+			http.Error(w, "host not found", http.StatusNotFound)
+			return
+		}
+		host = h
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.List(host, r.URL.Query().Get("key"))); err != nil {
+		http.Error(w, "failed to encode state", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,105 @@
+package zabbixsvc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+func TestStateList(t *testing.T) {
+	s := zabbixsvc.NewState()
+	s.Update(
+		zabbixsvc.StateEntry{Host: "b", Key: "prometheus.b", Value: "1"},
+		zabbixsvc.StateEntry{Host: "a", Key: "prometheus.b", Value: "1"},
+		zabbixsvc.StateEntry{Host: "a", Key: "prometheus.a", Value: "1"},
+		zabbixsvc.StateEntry{Host: "a", Key: "other.a", Value: "1"},
+	)
+	s.Update(zabbixsvc.StateEntry{Host: "a", Key: "prometheus.a", Value: "0"})
+
+	all := s.List("", "")
+	if len(all) != 4 {
+		t.Fatalf("Expected 4 entries, got %d", len(all))
+	}
+	if all[0].Key != "other.a" || all[1].Key != "prometheus.a" || all[3].Host != "b" {
+		t.Fatalf("Unexpected order: %+v", all)
+	}
+	if all[1].Value != "0" {
+		t.Fatalf("Expected updated value 0, got %s", all[1].Value)
+	}
+
+	if got := s.List("a", "prometheus."); len(got) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(got))
+	}
+}
+
+func TestStateHandler(t *testing.T) {
+	s := zabbixsvc.NewState()
+	s.Update(
+		zabbixsvc.StateEntry{Host: "a", Key: "prometheus.a", Value: "1"},
+		zabbixsvc.StateEntry{Host: "b", Key: "prometheus.b", Value: "1"},
+	)
+
+	for _, tc := range []struct {
+		path    string
+		code    int
+		entries int
+	}{
+		{path: zabbixsvc.StatePath, code: http.StatusOK, entries: 2},
+		{path: zabbixsvc.StatePath + "?host=a", code: http.StatusOK, entries: 1},
+		{path: zabbixsvc.StatePath + "?key=prometheus.b", code: http.StatusOK, entries: 1},
+		{path: zabbixsvc.StatePath + "/b", code: http.StatusOK, entries: 1},
+		{path: zabbixsvc.StatePath + "/c", code: http.StatusNotFound},
+	} {
+		rr := httptest.NewRecorder()
+		s.HandleState(rr, httptest.NewRequest("GET", tc.path, nil))
+
+		if rr.Code != tc.code {
+			t.Fatalf("%s: expected %d, got %d", tc.path, tc.code, rr.Code)
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+
+		var entries []zabbixsvc.StateEntry
+		if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != tc.entries {
+			t.Fatalf("%s: expected %d entries, got %d", tc.path, tc.entries, len(entries))
+		}
+	}
+}
+
+func TestJSONHandlerUpdatesState(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "Testing",
+		State:       zabbixsvc.NewState(),
+	}
+
+	rr := httptest.NewRecorder()
+	h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(alertInternal)))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code)
+	}
+	<-packets
+
+	entries := h.State.List("Testing", "")
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Key != "prometheus.instancedown" || e.Value != "1" || e.Receiver != "testing" || e.Labels["job"] != "node_exporter" {
+		t.Fatalf("Unexpected entry: %+v", e)
+	}
+	if e.Result == nil || e.Result.Response != "success" {
+		t.Fatalf("Expected successful result, got %+v", e.Result)
+	}
+}
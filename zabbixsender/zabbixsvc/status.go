@@ -0,0 +1,191 @@
+package zabbixsvc
+
+import (
+	"embed"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusPath is the path of the status page.
+const StatusPath = "/status"
+
+// statusDialTimeout limits the Zabbix connection check of the status page.
+const statusDialTimeout = 2 * time.Second
+
+// statusCheckInterval is the time the result of the Zabbix connection check is kept,
+// so that page loads don't open a connection to the trapper each.
+const statusCheckInterval = 30 * time.Second
+
+//go:embed templates/*.html
+var templates embed.FS
+
+var statusTemplate = template.Must(template.New("status.html").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Truncate(time.Second).String() + " ago"
+	},
+	"unix": func(clock int64) time.Time { return time.Unix(clock, 0) },
+}).ParseFS(templates, "templates/status.html"))
+
+// StatusPage serves a read-only HTML page with the config, routing, recent requests, Zabbix health,
+// queue and firing keys of zal send, for people who'd rather not read logs and metrics.
+type StatusPage struct {
+	Handler *JSONHandler
+	// Config is the running config as YAML, secrets must be redacted.
+	Config string
+	// ZabbixAddr is connected to check Zabbix can be reached, at most once per statusCheckInterval.
+	// Empty skips the check.
+	ZabbixAddr string
+	Version    string
+
+	started time.Time
+
+	mu        sync.Mutex
+	checked   time.Time
+	dialError string
+}
+
+// NewStatusPage creates StatusPage of the handler started now.
+func NewStatusPage(h *JSONHandler, config, zabbixAddr, version string) *StatusPage {
+	return &StatusPage{
+		Handler:    h,
+		Config:     config,
+		ZabbixAddr: zabbixAddr,
+		Version:    version,
+		started:    time.Now(),
+	}
+}
+
+// statusRoute is a row of the routing table.
+type statusRoute struct {
+	Receiver string
+	Host     string
+	Encoding string
+}
+
+// statusQueue is the async queue state.
+type statusQueue struct {
+	Queued int
+	Size   int
+}
+
+// statusData is rendered by the status template.
+type statusData struct {
+	Version   string
+	Started   time.Time
+	Config    string
+	Routes    []statusRoute
+	DryRun    bool
+	Zabbix    ZabbixHealth
+	Addr      string
+	DialError string
+	Checked   time.Time
+	Queue     *statusQueue
+	Dedupe    bool
+	Requests  []RequestRecord
+	Firing    []StateEntry
+}
+
+// HandleGet renders the status page.
+func (p *StatusPage) HandleGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h := p.Handler
+	data := statusData{
+		Version:  p.Version,
+		Started:  p.started,
+		Config:   p.Config,
+		Routes:   p.routes(),
+		DryRun:   h.DryRun,
+		Zabbix:   h.health.get(),
+		Addr:     p.ZabbixAddr,
+		Dedupe:   h.Dedupe != nil,
+		Requests: h.Requests.List(),
+		Firing:   p.firing(),
+	}
+
+	if h.Async != nil {
+		queued, size := h.Async.Queued()
+		data.Queue = &statusQueue{Queued: queued, Size: size}
+	}
+
+	if p.ZabbixAddr != "" && !h.DryRun {
+		data.DialError, data.Checked = p.dialZabbix()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, data); err != nil {
+		log.Errorf("error rendering status page: %v", err)
+	}
+}
+
+// dialZabbix returns the error of the last connection to Zabbix and when it was made,
+// the connection is made again when the result is older than statusCheckInterval.
+func (p *StatusPage) dialZabbix() (string, time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if now := time.Now(); now.Sub(p.checked) >= statusCheckInterval {
+		p.dialError = ""
+		conn, err := net.DialTimeout("tcp", p.ZabbixAddr, statusDialTimeout)
+		if err != nil {
+			p.dialError = err.Error()
+		} else {
+			conn.Close()
+		}
+		p.checked = now
+	}
+
+	return p.dialError, p.checked
+}
+
+// routes returns the routing table sorted by receiver, the default host is the last row.
+func (p *StatusPage) routes() []statusRoute {
+	h := p.Handler
+	encoding := func(host string) string {
+		if e := h.encoding(host); e != "" {
+			return e
+		}
+		return itemvalue.Numeric
+	}
+
+	routes := make([]statusRoute, 0, len(h.Hosts)+1)
+	for receiver, host := range h.Hosts {
+		routes = append(routes, statusRoute{Receiver: receiver, Host: host, Encoding: encoding(host)})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Receiver < routes[j].Receiver })
+
+	return append(routes, statusRoute{Receiver: "*", Host: h.DefaultHost, Encoding: encoding(h.DefaultHost)})
+}
+
+// firing returns state entries of firing alerts, sample values are skipped.
+func (p *StatusPage) firing() []StateEntry {
+	h := p.Handler
+	if h.State == nil {
+		return nil
+	}
+
+	var firing []StateEntry
+	for _, e := range h.State.List("", "") {
+		if h.Samples.Enabled() && strings.HasSuffix(e.Key, "."+h.Samples.Suffix()) {
+			continue
+		}
+		if itemvalue.Firing(h.encoding(e.Host), e.Value) {
+			firing = append(firing, e)
+		}
+	}
+	return firing
+}
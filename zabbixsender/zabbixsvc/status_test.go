@@ -0,0 +1,154 @@
+package zabbixsvc_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+func TestStatusPage(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Hosts:       map[string]string{"testing": "web1"},
+		State:       zabbixsvc.NewState(),
+		Requests:    zabbixsvc.NewRequestLog(10),
+	}
+
+	post(t, h, alertInternal)
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+	post(t, h, strings.Replace(alertInternal, `"receiver":"testing"`, `"receiver":"<script>"`, 1))
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+
+	// nothing listens on port 1
+	page := zabbixsvc.NewStatusPage(h, "zabbix:\n  password: <redacted>\n", "127.0.0.1:1", "v1.0.0")
+
+	rr := httptest.NewRecorder()
+	page.HandleGet(rr, httptest.NewRequest("GET", zabbixsvc.StatusPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status page, got %d", rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, expected := range []string{
+		"v1.0.0",
+		"<td>testing</td><td>web1</td><td>numeric</td>",
+		"<td>*</td><td>default</td><td>numeric</td>",
+		"<td>web1</td><td>prometheus.instancedown</td><td>1</td><td>testing</td>",
+		"<td>default</td><td>prometheus.instancedown</td><td>1</td><td>&lt;script&gt;</td>",
+		"connection refused",
+		"async sending is disabled",
+		"password: &lt;redacted&gt;",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected status page to contain %q, got:\n%s", expected, body)
+		}
+	}
+
+	// the newest request is the first one
+	if i, j := strings.Index(body, "<td>&lt;script&gt;</td><td>firing</td>"), strings.Index(body, "<td>testing</td><td>firing</td>"); i < 0 || j < 0 || i > j {
+		t.Errorf("Expected recent requests newest first, got:\n%s", body)
+	}
+
+	// resolved alerts are not firing
+	post(t, h, alertResolved)
+	expectPacket(t, packets, map[string]string{"prometheus.instancedown": "0"})
+
+	rr = httptest.NewRecorder()
+	page.HandleGet(rr, httptest.NewRequest("GET", zabbixsvc.StatusPath, nil))
+	if strings.Contains(rr.Body.String(), "<td>web1</td><td>prometheus.instancedown</td>") {
+		t.Errorf("Expected resolved alert not to be firing, got:\n%s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	page.HandleGet(rr, httptest.NewRequest("POST", zabbixsvc.StatusPath, nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Expected status page to be read-only, got %d", rr.Code)
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Requests:    zabbixsvc.NewRequestLog(2),
+	}
+
+	for _, receiver := range []string{"a", "b", "c"} {
+		post(t, h, strings.Replace(alertInternal, `"receiver":"testing"`, `"receiver":"`+receiver+`"`, 1))
+		expectPacket(t, packets, map[string]string{"prometheus.instancedown": "1"})
+	}
+
+	records := h.Requests.List()
+	if len(records) != 2 || records[0].Receiver != "c" || records[1].Receiver != "b" {
+		t.Fatalf("Expected the 2 newest requests, got %+v", records)
+	}
+	if records[0].Code != http.StatusOK || records[0].Alerts != 1 || records[0].Result.Status != "success" {
+		t.Fatalf("Unexpected request record: %+v", records[0])
+	}
+}
+
+func TestStatusPageDialCached(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+			accepted <- struct{}{}
+		}
+	}()
+
+	page := zabbixsvc.NewStatusPage(&zabbixsvc.JSONHandler{}, "", l.Addr().String(), "")
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		page.HandleGet(rr, httptest.NewRequest("GET", zabbixsvc.StatusPath, nil))
+		if !strings.Contains(rr.Body.String(), "reachable, checked") {
+			t.Fatalf("Expected Zabbix to be reachable, got:\n%s", rr.Body)
+		}
+	}
+
+	// page loads within the check interval reuse the result
+	<-accepted
+	select {
+	case <-accepted:
+		t.Fatal("Expected a single connection to Zabbix")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRequestLogWrap(t *testing.T) {
+	h := &zabbixsvc.JSONHandler{Requests: zabbixsvc.NewRequestLog(10)}
+
+	handler := h.Requests.Wrap("prometheus", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "request body is not valid json", http.StatusBadRequest)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("POST", zabbixsvc.AlertsAPIPath, strings.NewReader("[")))
+
+	records := h.Requests.List()
+	if len(records) != 1 || records[0].Path != zabbixsvc.AlertsAPIPath || records[0].Receiver != "prometheus" || records[0].Code != http.StatusBadRequest {
+		t.Fatalf("Unexpected request records: %+v", records)
+	}
+	if records[0].Result == nil || records[0].Result.Error != "request body is not valid json" {
+		t.Fatalf("Expected the error to be recorded, got %+v", records[0].Result)
+	}
+}
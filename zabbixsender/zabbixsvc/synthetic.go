@@ -0,0 +1,164 @@
+package zabbixsvc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// TestPath is the path of requests sending a synthetic alert to Zabbix.
+	TestPath = "/api/v1/test"
+	// TestAlertName is the alertname of synthetic alerts, its key is used when no key is requested.
+	TestAlertName = "ZalTest"
+	// TestReceiver is the receiver of synthetic alerts.
+	TestReceiver = "zal-test"
+
+	// DefaultTestDelay is the time between the firing and the resolved value of a synthetic alert.
+	DefaultTestDelay = 10 * time.Second
+	// MaxTestDelay limits the delay of test requests, as they are answered after the resolved value is sent.
+	MaxTestDelay = 5 * time.Minute
+
+	// testResolveTimeout limits sending of the resolved value after the test request was canceled.
+	testResolveTimeout = time.Minute
+)
+
+// TestRequest is the body of test requests, all fields are optional.
+type TestRequest struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Delay string `json:"delay"`
+}
+
+// TestResult reports Zabbix responses to the firing and the resolved value of a synthetic alert.
+type TestResult struct {
+	Host     string      `json:"host"`
+	Key      string      `json:"key"`
+	Firing   *SendResult `json:"firing"`
+	Resolved *SendResult `json:"resolved,omitempty"`
+}
+
+// Test sends a synthetic firing alert and resolves it after the delay, through the same routing and sender
+// path as received alerts. Empty host is the default host, empty key is the key of TestAlertName.
+// The result is returned also when sending fails, the resolved value is not sent when the firing one failed.
+// When ctx is done during the delay, the resolved value is still sent, so the test alert doesn't stay firing.
+func (h *JSONHandler) Test(ctx context.Context, host, key string, delay time.Duration) (*TestResult, error) {
+	if host == "" {
+		host = h.DefaultHost
+	}
+
+	alert := Alert{
+		Labels:      map[string]string{"alertname": TestAlertName},
+		Annotations: map[string]string{"summary": "Synthetic alert sent by zal to test delivery to Zabbix"},
+		StartsAt:    time.Now().Format(time.RFC3339Nano),
+	}
+	result := &TestResult{Host: host}
+
+	send := func(ctx context.Context, status string) (*SendResult, error) {
+		alert.Status = status
+		n, host, metrics := h.metrics(&Notification{Receiver: TestReceiver, Status: status, Alerts: []Alert{alert}, Host: host})
+		if key != "" {
+			metrics[0].Key = key
+		}
+		result.Key = metrics[0].Key
+
+		log.Infof("sending synthetic %s alert, host: '%s' key: '%s'", status, host, result.Key)
+		return h.deliver(ctx, n, host, metrics)
+	}
+
+	var err error
+	if result.Firing, err = send(ctx, "firing"); err != nil {
+		return result, errors.Wrap(err, "firing")
+	}
+
+	resolveCtx := ctx
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		// keep the span of the request, but not its cancellation
+		var cancel context.CancelFunc
+		resolveCtx, cancel = context.WithTimeout(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)), testResolveTimeout)
+		defer cancel()
+	}
+
+	alert.EndsAt = time.Now().Format(time.RFC3339Nano)
+	if result.Resolved, err = send(resolveCtx, "resolved"); err != nil {
+		return result, errors.Wrap(err, "resolved")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, errors.Wrap(err, "delay")
+	}
+	return result, nil
+}
+
+// TestAPI handles requests sending synthetic alerts, authenticated with a bearer token.
+type TestAPI struct {
+	Handler *JSONHandler
+	Token   string
+}
+
+// authorized reports whether the request has the bearer token.
+func (a *TestAPI) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if a.Token == "" || !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(a.Token)) == 1
+}
+
+// HandlePost sends a synthetic alert and answers with the Zabbix responses once it is resolved.
+func (a *TestAPI) HandlePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, span := startSpan(r, "TestAPI.HandlePost")
+	defer span.End()
+	defer r.Body.Close()
+
+	// empty body requests the defaults
+	var req TestRequest
+	if err := decode(ctx, r.Body, &req); err != nil && err != io.EOF {
+		http.Error(w, "request body is not valid json", http.StatusBadRequest)
+		return
+	}
+
+	delay := DefaultTestDelay
+	if req.Delay != "" {
+		var err error
+		if delay, err = time.ParseDuration(req.Delay); err != nil || delay < 0 || delay > MaxTestDelay {
+			http.Error(w, "delay must be a duration between 0 and "+MaxTestDelay.String(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := a.Handler.Test(ctx, req.Host, req.Key, delay)
+	code := http.StatusOK
+	if err != nil {
+		spanError(span, err)
+		log.Errorf("synthetic alert failed, host: '%s' key: '%s': %v", result.Host, result.Key, err)
+		code = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errorf("error writing response: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package zabbixsvc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+	"github.com/pkg/errors"
+)
+
+func TestTestAPI(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	a := &zabbixsvc.TestAPI{
+		Handler: &zabbixsvc.JSONHandler{Sender: s, KeyPrefix: "prometheus", DefaultHost: "host"},
+		Token:   "secret",
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		r := httptest.NewRequest("POST", zabbixsvc.TestPath, nil)
+		r.Header.Set("Authorization", auth)
+		rr := httptest.NewRecorder()
+		a.HandlePost(rr, r)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected authorization %q to be rejected, got %d", auth, rr.Code)
+		}
+	}
+	expectPacket(t, packets, nil)
+
+	r := httptest.NewRequest("POST", zabbixsvc.TestPath, strings.NewReader(`{"host": "web1", "delay": "10ms"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	a.HandlePost(rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected synthetic alert to be sent, got %d: %s", rr.Code, rr.Body)
+	}
+
+	var res zabbixsvc.TestResult
+	if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Host != "web1" || res.Key != "prometheus.zaltest" || res.Firing.Processed != 1 || res.Resolved == nil || res.Resolved.Processed != 1 {
+		t.Fatalf("Unexpected result: %+v", res)
+	}
+
+	expectPacket(t, packets, map[string]string{"prometheus.zaltest": "1"})
+	expectPacket(t, packets, map[string]string{"prometheus.zaltest": "0"})
+}
+
+func TestSyntheticFailed(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 0; failed: 1; total: 1; seconds spent: 0.000041")
+	h := &zabbixsvc.JSONHandler{Sender: s, KeyPrefix: "prometheus", DefaultHost: "host"}
+
+	res, err := h.Test(context.Background(), "", "zal.check", 0)
+	if err == nil {
+		t.Fatal("Expected failed synthetic alert")
+	}
+	if res.Host != "host" || res.Key != "zal.check" || res.Firing.Failed != 1 || res.Resolved != nil {
+		t.Fatalf("Expected only the failed firing value, got %+v", res)
+	}
+
+	expectPacket(t, packets, map[string]string{"zal.check": "1"})
+	expectPacket(t, packets, nil)
+}
+
+func TestSyntheticCanceled(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+	h := &zabbixsvc.JSONHandler{Sender: s, KeyPrefix: "prometheus", DefaultHost: "host"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	res, err := h.Test(ctx, "", "", zabbixsvc.MaxTestDelay)
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("Expected the delay to be cut short, got %v", err)
+	}
+	if res.Resolved == nil || res.Resolved.Processed != 1 {
+		t.Fatalf("Expected the resolved value to be sent, got %+v", res)
+	}
+
+	expectPacket(t, packets, map[string]string{"prometheus.zaltest": "1"})
+	expectPacket(t, packets, map[string]string{"prometheus.zaltest": "0"})
+}
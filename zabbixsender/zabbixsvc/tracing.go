@@ -0,0 +1,40 @@
+package zabbixsvc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc")
+
+// startSpan starts span of the request, continuing the trace of the incoming trace context headers.
+func startSpan(r *http.Request, name string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// spanError marks span as failed.
+func spanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// decode decodes JSON request body in its own span.
+func decode(ctx context.Context, r io.Reader, v interface{}) error {
+	_, span := tracer.Start(ctx, "decode")
+	defer span.End()
+
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		spanError(span, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package zabbixsvc_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	recorderOnce sync.Once
+	recorder     = tracetest.NewSpanRecorder()
+)
+
+func TestTracing(t *testing.T) {
+	// package tracers bind to the first global provider only
+	recorderOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	recorded := len(recorder.Ended())
+
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+	}
+
+	rw, err := zabbixsvc.NewRemoteWrite(h, zabbixsvc.RemoteWriteConfig{
+		BatchSize: 10,
+		Series:    []zabbixsvc.SeriesConfig{{Matchers: []string{`__name__="up"`}, Key: "prometheus.up"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := writeRequest(map[string][]testSample{"up": {{1, 1600000000000}}}, map[string]string{"__name__": "up"})
+	req := httptest.NewRequest("POST", zabbixsvc.RemoteWritePath, bytes.NewReader(body))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	rr := httptest.NewRecorder()
+	rw.HandlePost(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected no content, got %d: %s", rr.Code, rr.Body)
+	}
+	<-packets
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended()[recorded:] {
+		spans[span.Name()] = span
+		if id := span.SpanContext().TraceID().String(); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected span %s to continue incoming trace, got trace %s", span.Name(), id)
+		}
+	}
+
+	root, ok := spans["RemoteWrite.HandlePost"]
+	if !ok {
+		t.Fatalf("Expected request span, got %v", spans)
+	}
+	if id := root.Parent().SpanID().String(); id != "00f067aa0ba902b7" {
+		t.Errorf("Expected request span parent from traceparent, got %s", id)
+	}
+
+	send, ok := spans["zabbixsnd.Send"]
+	if !ok {
+		t.Fatalf("Expected zabbix send span, got %v", spans)
+	}
+	if send.Parent().TraceID() != root.SpanContext().TraceID() {
+		t.Errorf("Expected zabbix send span in request trace")
+	}
+}
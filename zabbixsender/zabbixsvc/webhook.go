@@ -0,0 +1,324 @@
+package zabbixsvc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookConfig maps alert-like JSON payloads of other tools to alerts.
+// Fields are text/template expressions executed with a single alert object as dot.
+type WebhookConfig struct {
+	// Path is the http path the webhook is served on.
+	Path string `yaml:"path"`
+	// Receiver is used to resolve the Zabbix host, defaults to Path.
+	Receiver string `yaml:"receiver"`
+	// Alerts is a dotted path to the array of alerts in the payload, e.g. "data.events".
+	// Empty path means the whole payload is a single alert.
+	Alerts    string `yaml:"alerts"`
+	AlertName string `yaml:"alertname"`
+	Status    string `yaml:"status"`
+	// FiringValues are status values which mean the alert is firing, case insensitive.
+	// Any other value resolves the alert. Defaults to "firing".
+	FiringValues []string          `yaml:"firingValues"`
+	Labels       map[string]string `yaml:"labels"`
+	// LabelsPath is a dotted path to an object in the alert, whose fields are copied to labels.
+	LabelsPath      string            `yaml:"labelsPath"`
+	Annotations     map[string]string `yaml:"annotations"`
+	AnnotationsPath string            `yaml:"annotationsPath"`
+	StartsAt        string            `yaml:"startsAt"`
+	EndsAt          string            `yaml:"endsAt"`
+}
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"default": func(def string, v interface{}) string {
+		if v == nil || fmt.Sprint(v) == "" {
+			return def
+		}
+		return fmt.Sprint(v)
+	},
+}
+
+// Webhook handles a generic JSON webhook.
+type Webhook struct {
+	Handler *JSONHandler
+
+	path         string
+	receiver     string
+	alerts       string
+	firingValues []string
+	labelsPath   string
+	annotPath    string
+
+	alertName   *template.Template
+	status      *template.Template
+	labels      map[string]*template.Template
+	annotations map[string]*template.Template
+	startsAt    *template.Template
+	endsAt      *template.Template
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s template", name)
+	}
+	return t, nil
+}
+
+func parseTemplates(name string, texts map[string]string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template, len(texts))
+	for k, text := range texts {
+		t, err := parseTemplate(fmt.Sprintf("%s.%s", name, k), text)
+		if err != nil {
+			return nil, err
+		}
+		templates[k] = t
+	}
+	return templates, nil
+}
+
+// Validate checks that all required fields are set and templates can be parsed.
+func (cfg WebhookConfig) Validate() error {
+	_, err := NewWebhook(nil, cfg)
+	return err
+}
+
+// NewWebhook parses templates of the webhook config.
+func NewWebhook(h *JSONHandler, cfg WebhookConfig) (*Webhook, error) {
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return nil, errors.Errorf("path must start with /, got %q", cfg.Path)
+	}
+
+	if cfg.AlertName == "" || cfg.Status == "" {
+		return nil, errors.New("alertname and status are required")
+	}
+
+	wh := &Webhook{
+		Handler:      h,
+		path:         cfg.Path,
+		receiver:     cfg.Receiver,
+		alerts:       cfg.Alerts,
+		firingValues: cfg.FiringValues,
+		labelsPath:   cfg.LabelsPath,
+		annotPath:    cfg.AnnotationsPath,
+	}
+	if wh.receiver == "" {
+		wh.receiver = cfg.Path
+	}
+	if len(wh.firingValues) == 0 {
+		wh.firingValues = []string{"firing"}
+	}
+
+	var err error
+	for _, t := range []struct {
+		dst  **template.Template
+		name string
+		text string
+	}{
+		{&wh.alertName, "alertname", cfg.AlertName},
+		{&wh.status, "status", cfg.Status},
+		{&wh.startsAt, "startsAt", cfg.StartsAt},
+		{&wh.endsAt, "endsAt", cfg.EndsAt},
+	} {
+		if *t.dst, err = parseTemplate(t.name, t.text); err != nil {
+			return nil, err
+		}
+	}
+
+	if wh.labels, err = parseTemplates("labels", cfg.Labels); err != nil {
+		return nil, err
+	}
+	if wh.annotations, err = parseTemplates("annotations", cfg.Annotations); err != nil {
+		return nil, err
+	}
+
+	return wh, nil
+}
+
+// lookup follows dotted path in decoded JSON, empty path returns v.
+func lookup(v interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return v, true
+	}
+
+	for _, field := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+func execute(t *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	s := strings.TrimSpace(buf.String())
+	if s == "<no value>" {
+		return "", nil
+	}
+	return s, nil
+}
+
+func (wh *Webhook) copyFields(dst map[string]string, data interface{}, path string) {
+	if path == "" {
+		return
+	}
+
+	v, ok := lookup(data, path)
+	if !ok {
+		return
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for k, v := range m {
+		if v != nil {
+			dst[k] = fmt.Sprint(v)
+		}
+	}
+}
+
+func (wh *Webhook) executeAll(dst map[string]string, templates map[string]*template.Template, data interface{}) error {
+	for k, t := range templates {
+		v, err := execute(t, data)
+		if err != nil {
+			return err
+		}
+		if v != "" {
+			dst[k] = v
+		}
+	}
+	return nil
+}
+
+// alert maps a single alert object.
+func (wh *Webhook) alert(data interface{}) (Alert, error) {
+	alert := Alert{
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+	}
+
+	wh.copyFields(alert.Labels, data, wh.labelsPath)
+	if err := wh.executeAll(alert.Labels, wh.labels, data); err != nil {
+		return alert, err
+	}
+
+	wh.copyFields(alert.Annotations, data, wh.annotPath)
+	if err := wh.executeAll(alert.Annotations, wh.annotations, data); err != nil {
+		return alert, err
+	}
+
+	name, err := execute(wh.alertName, data)
+	if err != nil {
+		return alert, err
+	}
+	if name == "" {
+		return alert, errors.New("empty alertname")
+	}
+	alert.Labels["alertname"] = name
+
+	status, err := execute(wh.status, data)
+	if err != nil {
+		return alert, err
+	}
+	alert.Status = "resolved"
+	for _, v := range wh.firingValues {
+		if strings.EqualFold(status, v) {
+			alert.Status = "firing"
+		}
+	}
+
+	if alert.StartsAt, err = execute(wh.startsAt, data); err != nil {
+		return alert, err
+	}
+	if alert.EndsAt, err = execute(wh.endsAt, data); err != nil {
+		return alert, err
+	}
+
+	return alert, nil
+}
+
+// notification maps the decoded payload to alerts.
+func (wh *Webhook) notification(payload interface{}) (*Notification, error) {
+	v, ok := lookup(payload, wh.alerts)
+	if !ok {
+		return nil, errors.Errorf("alerts not found in path %q", wh.alerts)
+	}
+
+	items := []interface{}{v}
+	if wh.alerts != "" {
+		if items, ok = v.([]interface{}); !ok {
+			return nil, errors.Errorf("alerts in path %q are not an array", wh.alerts)
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("no alerts in payload")
+	}
+
+	n := &Notification{Receiver: wh.receiver, Status: "resolved"}
+	for i, item := range items {
+		alert, err := wh.alert(item)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't map alert %d", i)
+		}
+
+		if alert.Status == "firing" {
+			n.Status = "firing"
+		}
+		n.Alerts = append(n.Alerts, alert)
+	}
+
+	return n, nil
+}
+
+// HandlePost handles a generic JSON webhook.
+func (wh *Webhook) HandlePost(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r, "Webhook.HandlePost")
+	defer span.End()
+
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	defer r.Body.Close()
+
+	var payload interface{}
+	if err := dec.Decode(&payload); err != nil {
+		alertsErrorsTotal.WithLabelValues("", wh.receiver).Inc()
+
+		log.Errorf("error decoding webhook message: %v", err)
+		http.Error(w, "request body is not valid json", http.StatusBadRequest)
+		return
+	}
+
+	n, err := wh.notification(payload)
+	if err != nil {
+		alertsErrorsTotal.WithLabelValues("", wh.receiver).Inc()
+
+		log.Errorf("error mapping webhook message, receiver: %s, error: %v", wh.receiver, err)
+		http.Error(w, "missing fields in request body", http.StatusBadRequest)
+		return
+	}
+
+	wh.Handler.handleNotification(ctx, w, n)
+}
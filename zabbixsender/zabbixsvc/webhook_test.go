@@ -0,0 +1,130 @@
+package zabbixsvc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
+)
+
+const webhookPayload = `{
+	"data": {
+		"events": [
+			{"check": "BackupFailed", "state": "PROBLEM", "host": "DB1", "message": "backup failed", "tags": {"team": "dba", "retries": 3}},
+			{"check": "BackupSlow", "state": "OK", "host": "DB1", "message": "backup ok"}
+		]
+	}
+}`
+
+func TestWebhook(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 2; failed: 0; total: 2; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:      s,
+		KeyPrefix:   "prometheus",
+		DefaultHost: "default",
+		Hosts:       map[string]string{"backup": "backup-host"},
+		State:       zabbixsvc.NewState(),
+	}
+
+	wh, err := zabbixsvc.NewWebhook(h, zabbixsvc.WebhookConfig{
+		Path:         "/webhooks/backup",
+		Receiver:     "backup",
+		Alerts:       "data.events",
+		AlertName:    "{{ .check }}",
+		Status:       "{{ .state }}",
+		FiringValues: []string{"problem"},
+		LabelsPath:   "tags",
+		Labels:       map[string]string{"instance": "{{ .host | lower }}", "missing": "{{ .nothing }}"},
+		Annotations:  map[string]string{"summary": "{{ .message }}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	wh.HandlePost(rr, httptest.NewRequest("POST", "/webhooks/backup", strings.NewReader(webhookPayload)))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code, rr.Body.String())
+	}
+
+	p := <-packets
+	expected := map[string]string{"prometheus.backupfailed": "1", "prometheus.backupslow": "0"}
+	if len(p.Data) != 2 {
+		t.Fatalf("Expected 2 metrics, got %d", len(p.Data))
+	}
+	for _, m := range p.Data {
+		if m.Host != "backup-host" || expected[m.Key] != m.Value {
+			t.Errorf("Unexpected metric: %+v", m)
+		}
+	}
+
+	entries := h.State.List("backup-host", "prometheus.backupfailed")
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 state entry, got %d", len(entries))
+	}
+	labels := entries[0].Labels
+	if labels["team"] != "dba" || labels["retries"] != "3" || labels["instance"] != "db1" || labels["alertname"] != "BackupFailed" {
+		t.Fatalf("Unexpected labels: %v", labels)
+	}
+	if _, ok := labels["missing"]; ok {
+		t.Fatalf("Expected missing label to be skipped: %v", labels)
+	}
+}
+
+func TestWebhookSingleAlert(t *testing.T) {
+	s, packets := fakeZabbix(t, "processed: 1; failed: 0; total: 1; seconds spent: 0.000041")
+
+	h := &zabbixsvc.JSONHandler{Sender: s, KeyPrefix: "prometheus", DefaultHost: "default"}
+	wh, err := zabbixsvc.NewWebhook(h, zabbixsvc.WebhookConfig{
+		Path:      "/webhooks/single",
+		AlertName: "{{ .name }}",
+		Status:    `{{ if .active }}firing{{ else }}resolved{{ end }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	wh.HandlePost(rr, httptest.NewRequest("POST", "/webhooks/single", strings.NewReader(`{"name": "Single", "active": true}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code, rr.Body.String())
+	}
+
+	p := <-packets
+	if len(p.Data) != 1 || p.Data[0].Key != "prometheus.single" || p.Data[0].Value != "1" || p.Data[0].Host != "default" {
+		t.Fatalf("Unexpected metrics: %+v", p.Data)
+	}
+}
+
+func TestWebhookErrors(t *testing.T) {
+	for _, cfg := range []zabbixsvc.WebhookConfig{
+		{Path: "webhook", AlertName: "{{ .name }}", Status: "{{ .status }}"},
+		{Path: "/webhook", Status: "{{ .status }}"},
+		{Path: "/webhook", AlertName: "{{ .name ", Status: "{{ .status }}"},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected invalid config: %+v", cfg)
+		}
+	}
+
+	wh, err := zabbixsvc.NewWebhook(&zabbixsvc.JSONHandler{}, zabbixsvc.WebhookConfig{
+		Path:      "/webhook",
+		Alerts:    "events",
+		AlertName: "{{ .name }}",
+		Status:    "{{ .status }}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{`{"events": {}}`, `{"events": []}`, `{"other": []}`, `{"events": [{"status": "firing"}]}`, `{`} {
+		rr := httptest.NewRecorder()
+		wh.HandlePost(rr, httptest.NewRequest("POST", "/webhook", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected bad request for %s, got %d", body, rr.Code)
+		}
+	}
+}
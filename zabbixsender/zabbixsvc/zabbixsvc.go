@@ -1,21 +1,32 @@
 package zabbixsvc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/devopyio/zabbix-alertmanager/itemkey"
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
 	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	yaml "gopkg.in/yaml.v2"
 )
 
+const (
+	// SourceLabel marks alerts created by zal from Zabbix problems.
+	SourceLabel = "zal_source"
+	// SourceZabbix is the SourceLabel value of alerts pulled from Zabbix, they are not sent back to Zabbix.
+	SourceZabbix = "zabbix"
+)
+
 // AlertmanageRequest this is request received from Alertmanager.
 type AlertmanagerRequest struct {
 	Version           string            `json:"version"`
@@ -31,23 +42,119 @@ type AlertmanagerRequest struct {
 
 // Alert is alert received from alertmanager.
 type Alert struct {
+	Status      string            `json:"status,omitempty"`
+	Fingerprint string            `json:"fingerprint,omitempty"`
 	Labels      map[string]string `json:"labels"`
 	Annotations map[string]string `json:"annotations"`
 	StartsAt    string            `json:"startsAt,omitempty"`
 	EndsAt      string            `json:"EndsAt,omitempty"`
+
+	// receivedAt orders values of alerts pushed to the alerts api, which keep their startsAt when they fire again.
+	receivedAt time.Time
+}
+
+// Notification is a group of alerts for a single receiver, decoded from any of the supported sources.
+type Notification struct {
+	Receiver string
+	// Status is the status of the whole group, value of each alert is decided by the alert status.
+	Status string
+	Alerts []Alert
+	// Host overrides the host of the receiver, KeyPrefix overrides the handler key prefix.
+	Host      string
+	KeyPrefix string
+	// GroupKey identifies the Alertmanager or Grafana group of the alerts, empty for other sources.
+	GroupKey string
 }
 
 type ZabbixResponse struct {
 	Response string `json:"response"`
 	Info     string `json:"info"`
+	// Rejected are the metrics Zabbix rejected, found by bisecting the packet.
+	Rejected []*zabbixsnd.Metric `json:"-"`
+}
+
+// Summary parses processed, failed and total counts of the Zabbix info, e.g.
+// "processed: 1; failed: 0; total: 1; seconds spent: 0.000041".
+func (res *ZabbixResponse) Summary() (processed, failed, total int, err error) {
+	var seconds float64
+	if _, err := fmt.Sscanf(res.Info, "processed: %d; failed: %d; total: %d; seconds spent: %f", &processed, &failed, &total, &seconds); err != nil {
+		return 0, 0, 0, errors.Wrapf(err, "unexpected zabbix info %q", res.Info)
+	}
+	return processed, failed, total, nil
+}
+
+// SendResult is the JSON response body of alert requests, it lists the metrics sent to Zabbix
+// and the Zabbix processed/failed summary.
+type SendResult struct {
+	// Status is "success" or "error".
+	Status  string              `json:"status"`
+	Error   string              `json:"error,omitempty"`
+	Metrics []*zabbixsnd.Metric `json:"metrics"`
+	// Rejected are the metrics Zabbix rejected, reported when rejected metrics are bisected.
+	Rejected []*zabbixsnd.Metric `json:"rejected,omitempty"`
+	// Response and Info are the Zabbix response, empty when Zabbix couldn't be reached.
+	Response  string `json:"response,omitempty"`
+	Info      string `json:"info,omitempty"`
+	Processed int    `json:"processed"`
+	Failed    int    `json:"failed"`
+	Total     int    `json:"total"`
+}
+
+// newSendResult creates result of metrics sent with the Zabbix response res and error err, both may be nil.
+func newSendResult(metrics []*zabbixsnd.Metric, res *ZabbixResponse, err error) *SendResult {
+	result := &SendResult{Status: "success", Metrics: metrics}
+	if result.Metrics == nil {
+		result.Metrics = []*zabbixsnd.Metric{}
+	}
+
+	if res != nil {
+		result.Response = res.Response
+		result.Info = res.Info
+		result.Rejected = res.Rejected
+		result.Processed, result.Failed, result.Total, _ = res.Summary()
+	}
+
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+
+	return result
 }
 
 // JSONHandler handles alerts
 type JSONHandler struct {
-	Sender      *zabbixsnd.Sender
-	KeyPrefix   string
+	Sender    *zabbixsnd.Sender
+	KeyPrefix string
+	// Keys sanitizes, truncates and aliases alert names of item keys.
+	Keys        itemkey.Config
 	DefaultHost string
 	Hosts       map[string]string
+	// Encoding is the value encoding of alert status, Encodings overrides it by host.
+	Encoding  string
+	Encodings map[string]string
+	// Samples forwards sample values of alerts to float items next to their items.
+	Samples itemvalue.SampleConfig
+	State   *State
+	// DryRun logs and records metrics instead of sending them to Zabbix.
+	DryRun bool
+	// Retries is the number of times a send is retried when Zabbix can't be reached.
+	Retries      int
+	RetryBackoff time.Duration
+	// Async queues notifications and sends them in the background, nil sends them within the request.
+	Async *Async
+	// Order serialises sends of the same items and drops alert values older than the values sent before,
+	// nil sends values as they are received.
+	Order *Order
+	// Dedupe drops Alertmanager notifications received again within its window, nil sends all of them.
+	Dedupe *Dedupe
+	// BisectRejected splits packets partly rejected by Zabbix to find the rejected metrics.
+	// Requests with rejected metrics then succeed, as resending them would fail again.
+	BisectRejected bool
+	// Requests keeps recent notifications and their results for the status page, nil keeps none.
+	Requests *RequestLog
+
+	health zabbixHealth
 }
 
 var (
@@ -66,14 +173,23 @@ var (
 		},
 		[]string{"alert_status", "host"},
 	)
+
+	dryRunMetricsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "alerts_dry_run_metrics_total",
+			Help: "Current number of metrics which would have been sent in dry run mode",
+		},
+		[]string{"host", "key"},
+	)
 )
 
 func (h *JSONHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
-	dec := json.NewDecoder(r.Body)
+	ctx, span := startSpan(r, "HandlePost")
+	defer span.End()
 	defer r.Body.Close()
 
 	var req AlertmanagerRequest
-	if err := dec.Decode(&req); err != nil {
+	if err := decode(ctx, r.Body, &req); err != nil {
 		alertsErrorsTotal.WithLabelValues("", "").Inc()
 
 		log.Errorf("error decoding message: %v", err)
@@ -81,28 +197,199 @@ func (h *JSONHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Status == "" || req.CommonLabels["alertname"] == "" {
+	if !req.valid() {
 		alertsErrorsTotal.WithLabelValues(req.Status, req.Receiver).Inc()
 		http.Error(w, "missing fields in request body", http.StatusBadRequest)
 		return
 	}
 
-	value := "0"
-	if req.Status == "firing" {
-		value = "1"
+	h.handleNotification(ctx, w, req.notification())
+}
+
+func (req *AlertmanagerRequest) valid() bool {
+	return req.Status != "" && req.CommonLabels["alertname"] != ""
+}
+
+// notification reports all alerts with the group status, as Alertmanager groups alerts by alertname.
+func (req *AlertmanagerRequest) notification() *Notification {
+	alerts := make([]Alert, len(req.Alerts))
+	for i, alert := range req.Alerts {
+		alert.Status = req.Status
+		alerts[i] = alert
 	}
 
-	host, ok := h.Hosts[req.Receiver]
+	return &Notification{
+		Receiver: req.Receiver,
+		Status:   req.Status,
+		Alerts:   alerts,
+		GroupKey: req.GroupKey,
+	}
+}
+
+// handleNotification sends alerts to Zabbix, or queues them in async mode, and writes the result as JSON.
+// Failed sends are answered with 500, so Alertmanager retries the notification.
+func (h *JSONHandler) handleNotification(ctx context.Context, w http.ResponseWriter, n *Notification) {
+	result, code := h.notify(ctx, n, h.Async != nil)
+	writeResult(w, code, result)
+}
+
+// notify sends alerts to Zabbix, or queues them when async is set, and records the notification in the request log.
+// It returns the result and the status code of the response, 500 when sending failed.
+func (h *JSONHandler) notify(ctx context.Context, n *Notification, async bool) (*SendResult, int) {
+	key, ok := h.Dedupe.add(n)
+	if !ok {
+		duplicateNotificationsTotal.WithLabelValues(n.Receiver).Inc()
+		log.Debugf("not sending duplicate notification, receiver: %s, group key: %s", n.Receiver, n.GroupKey)
+
+		result := emptyResult()
+		result.Status = "duplicate"
+		h.Requests.add(n, http.StatusOK, result)
+		return result, http.StatusOK
+	}
+
+	var result *SendResult
+	code := http.StatusOK
+	if async {
+		result, code = h.Async.enqueue(ctx, n)
+	} else {
+		var err error
+		if result, err = h.sendNotification(ctx, n); err != nil {
+			code = http.StatusInternalServerError
+		}
+	}
+
+	// retries of failed notifications are sent again
+	if code >= http.StatusBadRequest {
+		h.Dedupe.forget(key)
+	}
+	h.Requests.add(n, code, result)
+	return result, code
+}
+
+func writeResult(w http.ResponseWriter, code int, result *SendResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errorf("error writing response: %v", err)
+	}
+}
+
+// sendNotification sends alerts to Zabbix and records them in the state.
+// The result is returned also when sending fails.
+func (h *JSONHandler) sendNotification(ctx context.Context, n *Notification) (*SendResult, error) {
+	ctx, span := tracer.Start(ctx, "sendNotification", trace.WithAttributes(
+		attribute.String("zal.receiver", n.Receiver),
+		attribute.String("zal.status", n.Status),
+		attribute.Int("zal.alerts", len(n.Alerts)),
+	))
+	defer span.End()
+
+	n, host, metrics := h.route(ctx, n)
+	if len(metrics) == 0 {
+		return emptyResult(), nil
+	}
+
+	return h.deliver(ctx, n, host, metrics)
+}
+
+// emptyResult is the result of notifications without alerts to send.
+func emptyResult() *SendResult {
+	return newSendResult(nil, &ZabbixResponse{Response: "success", Info: "processed: 0; failed: 0; total: 0; seconds spent: 0"}, nil)
+}
+
+// route drops pulled alerts and creates metrics of the remaining alerts of the notification.
+func (h *JSONHandler) route(ctx context.Context, n *Notification) (*Notification, string, []*zabbixsnd.Metric) {
+	n = withoutPulled(n)
+	if len(n.Alerts) == 0 {
+		log.Debugf("not sending alerts pulled from zabbix, receiver: %s", n.Receiver)
+		return n, "", nil
+	}
+
+	_, span := tracer.Start(ctx, "route")
+	defer span.End()
+
+	n, host, metrics := h.metrics(n)
+	span.SetAttributes(attribute.String("zabbix.host", host), attribute.Int("zabbix.keys", len(metrics)))
+
+	return n, host, metrics
+}
+
+// deliver sends metrics of the notification alerts to Zabbix in order and records them in the state.
+func (h *JSONHandler) deliver(ctx context.Context, n *Notification, host string, metrics []*zabbixsnd.Metric) (*SendResult, error) {
+	unlock := h.Order.lock(metrics)
+	defer unlock()
+
+	n, metrics = h.Order.fresh(n, metrics)
+	if len(metrics) == 0 {
+		return emptyResult(), nil
+	}
+
+	alertsSentStats.WithLabelValues(n.Status, host).Inc()
+
+	res, err := h.zabbixSend(ctx, metrics)
+	if err != nil {
+		spanError(trace.SpanFromContext(ctx), err)
+		alertsErrorsTotal.WithLabelValues(n.Status, host).Add(float64(len(n.Alerts)))
+		log.Errorf("failed to send to server, metrics: %v, error: %s, raw request: %v", metrics, err, n)
+		return newSendResult(metrics, res, err), err
+	}
+
+	h.Order.record(n, metrics, res)
+	h.updateState(n, metrics, res)
+
+	log.Debugf("request succesfully sent: %v", res)
+	return newSendResult(metrics, res, nil), nil
+}
+
+// withoutPulled drops alerts of Zabbix problems, so they don't loop back to Zabbix.
+func withoutPulled(n *Notification) *Notification {
+	alerts := make([]Alert, 0, len(n.Alerts))
+	for _, alert := range n.Alerts {
+		if alert.Labels[SourceLabel] == SourceZabbix {
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if len(alerts) == len(n.Alerts) {
+		return n
+	}
+
+	res := *n
+	res.Alerts = alerts
+	return &res
+}
+
+// metrics resolves the Zabbix host of the notification or its receiver and creates a metric for every alert
+// and for every sample value. Alerts of the returned notification are the alerts of the metrics.
+func (h *JSONHandler) metrics(n *Notification) (*Notification, string, []*zabbixsnd.Metric) {
+	host, ok := n.Host, n.Host != ""
+	if !ok {
+		host, ok = h.Hosts[n.Receiver]
+	}
 	if !ok {
 		host = h.DefaultHost
-		log.Warnf("using default host %s, receiver not found: %s", host, req.Receiver)
+		log.Warnf("using default host %s, receiver not found: %s", host, n.Receiver)
 	}
 
-	alertsSentStats.WithLabelValues(req.Status, host).Inc()
+	keyPrefix := h.KeyPrefix
+	if n.KeyPrefix != "" {
+		keyPrefix = n.KeyPrefix
+	}
 
 	var metrics []*zabbixsnd.Metric
-	for _, alert := range req.Alerts {
-		key := fmt.Sprintf("%s.%s", h.KeyPrefix, strings.ToLower(alert.Labels["alertname"]))
+	var samples []*zabbixsnd.Metric
+	var sampled []Alert
+	for _, alert := range n.Alerts {
+		value := itemvalue.Encode(h.encoding(host), itemvalue.Alert{
+			Status:      alert.Status,
+			Labels:      alert.Labels,
+			Annotations: alert.Annotations,
+			StartsAt:    alert.StartsAt,
+			EndsAt:      alert.EndsAt,
+		})
+
+		key := h.Keys.Key(keyPrefix, alert.Labels["alertname"])
 		m := &zabbixsnd.Metric{Host: host, Key: key, Value: value}
 
 		m.Clock = time.Now().Unix()
@@ -110,40 +397,181 @@ func (h *JSONHandler) HandlePost(w http.ResponseWriter, r *http.Request) {
 		metrics = append(metrics, m)
 
 		log.Debugf("sending zabbix metrics, host: '%s' key: '%s', value: '%s'", host, key, value)
+
+		// resolved alerts keep the value they fired with, it is not sent again
+		if sample, ok := h.Samples.Sample(alert.Labels, alert.Annotations); ok && alert.Status == "firing" {
+			key := h.Keys.SuffixedKey(keyPrefix, alert.Labels["alertname"], h.Samples.Suffix())
+			samples = append(samples, &zabbixsnd.Metric{Host: host, Key: key, Value: sample, Clock: m.Clock})
+			sampled = append(sampled, alert)
+
+			log.Debugf("sending zabbix metrics, host: '%s' key: '%s', value: '%s'", host, key, sample)
+		}
 	}
 
-	res, err := h.zabbixSend(metrics)
-	if err != nil {
-		alertsErrorsTotal.WithLabelValues(req.Status, host).Add(float64(len(req.Alerts)))
-		log.Errorf("failed to send to server, metrics: %v, error: %s, raw request: %v", metrics, err, req)
-		http.Error(w, "failed to send to server", http.StatusInternalServerError)
+	if len(samples) != 0 {
+		res := *n
+		res.Alerts = append(append([]Alert{}, n.Alerts...), sampled...)
+		n = &res
+		metrics = append(metrics, samples...)
+	}
+
+	return n, host, metrics
+}
+
+// encoding returns the value encoding of items of the host.
+func (h *JSONHandler) encoding(host string) string {
+	if encoding, ok := h.Encodings[host]; ok {
+		return encoding
+	}
+	return h.Encoding
+}
+
+// key returns the Zabbix item key of the alertname.
+func (h *JSONHandler) key(alertname string) string {
+	return h.Keys.Key(h.KeyPrefix, alertname)
+}
+
+func (h *JSONHandler) updateState(n *Notification, metrics []*zabbixsnd.Metric, res *ZabbixResponse) {
+	if h.State == nil {
 		return
 	}
 
-	log.Debugf("request succesfully sent: %s", res)
+	rejected := map[*zabbixsnd.Metric]bool{}
+	for _, m := range res.Rejected {
+		rejected[m] = true
+	}
+
+	entries := make([]StateEntry, 0, len(metrics))
+	for i, m := range metrics {
+		// rejected values are not set in Zabbix
+		if rejected[m] {
+			continue
+		}
+		entries = append(entries, StateEntry{
+			Host:     m.Host,
+			Key:      m.Key,
+			Value:    m.Value,
+			Clock:    m.Clock,
+			Receiver: n.Receiver,
+			Labels:   n.Alerts[i].Labels,
+			Result:   res,
+		})
+	}
+	h.State.Update(entries...)
 }
 
-func (h *JSONHandler) zabbixSend(metrics []*zabbixsnd.Metric) (*ZabbixResponse, error) {
-	var zres ZabbixResponse
+// zabbixSend sends metrics to Zabbix, the response is returned also when Zabbix rejected metrics.
+func (h *JSONHandler) zabbixSend(ctx context.Context, metrics []*zabbixsnd.Metric) (*ZabbixResponse, error) {
+	ctx, span := tracer.Start(ctx, "zabbixSend", trace.WithAttributes(
+		attribute.Int("zabbix.keys", len(metrics)),
+		attribute.Bool("zal.dry_run", h.DryRun),
+	))
+	defer span.End()
+
+	if h.DryRun {
+		return dryRunSend(metrics), nil
+	}
+
+	zres, failed, err := h.sendMetrics(ctx, metrics)
+	if err != nil {
+		spanError(span, err)
+		return zres, err
+	}
+	span.SetAttributes(attribute.String("zabbix.response", zres.Response), attribute.String("zabbix.info", zres.Info))
+
+	if failed != 0 && zres.Response == "success" && h.BisectRejected {
+		rejected, err := h.bisect(ctx, metrics, failed)
+		if err != nil {
+			err = errors.Wrap(err, "error finding rejected metrics")
+			spanError(span, err)
+			return zres, err
+		}
+		span.SetAttributes(attribute.Int("zabbix.rejected", len(rejected)))
+
+		logRejected(rejected)
+		zres.Rejected = rejected
+		return zres, nil
+	}
+
+	if failed != 0 || zres.Response != "success" {
+		err := &rejectedError{failed: failed, res: zres}
+		spanError(span, err)
+		return zres, err
+	}
+
+	return zres, nil
+}
+
+// rejectedError is returned when Zabbix answered, but failed to process the metrics. Sending them again
+// would fail the same way, unlike when Zabbix can't be reached.
+type rejectedError struct {
+	failed int
+	res    *ZabbixResponse
+}
 
-	packet := zabbixsnd.NewPacket(metrics)
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("failed to fulfill the requests: %v, info: %v, Data: %v", e.failed, e.res.Info, e.res.Response)
+}
 
-	res, err := h.Sender.Send(packet)
+// sendMetrics sends metrics in a single packet and returns the response and the number of failed metrics.
+func (h *JSONHandler) sendMetrics(ctx context.Context, metrics []*zabbixsnd.Metric) (*ZabbixResponse, int, error) {
+	res, err := h.send(ctx, zabbixsnd.NewPacket(metrics))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	if len(res) < len(zabbixsnd.Header)+8 {
+		return nil, 0, errors.Errorf("zabbix response is too short: %q", res)
 	}
 
-	if err := json.Unmarshal(res[13:], &zres); err != nil {
-		return nil, err
+	var zres ZabbixResponse
+	if err := json.Unmarshal(res[len(zabbixsnd.Header)+8:], &zres); err != nil {
+		return nil, 0, err
 	}
-	infoSplit := strings.Split(zres.Info, " ")
 
-	failed := strings.Trim(infoSplit[3], ";")
-	if failed != "0" || zres.Response != "success" {
-		return nil, errors.Errorf("failed to fulfill the requests: %v, info: %v, Data: %v", failed, zres.Info, zres.Response)
+	_, failed, _, err := zres.Summary()
+	if err != nil {
+		return &zres, 0, err
 	}
 
-	return &zres, nil
+	return &zres, failed, nil
+}
+
+// send sends packet, retrying when Zabbix can't be reached until ctx is done.
+// Rejected metrics are not retried, as Zabbix would reject them again.
+func (h *JSONHandler) send(ctx context.Context, packet *zabbixsnd.Packet) ([]byte, error) {
+	res, err := h.Sender.SendContext(ctx, packet)
+	for i := 0; err != nil && i < h.Retries; i++ {
+		log.Warnf("failed to send to server, retrying in %s, attempt: %d/%d, error: %s", h.RetryBackoff, i+1, h.Retries, err)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("zal.attempt", i+1),
+			attribute.String("zal.error", err.Error()),
+		))
+		select {
+		case <-time.After(h.RetryBackoff):
+		case <-ctx.Done():
+			h.health.record(err)
+			return nil, ctx.Err()
+		}
+
+		res, err = h.Sender.SendContext(ctx, packet)
+	}
+
+	h.health.record(err)
+	return res, err
+}
+
+// dryRunSend logs metrics and responds as if Zabbix processed all of them.
+func dryRunSend(metrics []*zabbixsnd.Metric) *ZabbixResponse {
+	for _, m := range metrics {
+		dryRunMetricsTotal.WithLabelValues(m.Host, m.Key).Inc()
+		log.Infof("dry run, not sending zabbix metric, host: '%s' key: '%s', value: '%s', clock: %d", m.Host, m.Key, m.Value, m.Clock)
+	}
+
+	return &ZabbixResponse{
+		Response: "dry run",
+		Info:     fmt.Sprintf("processed: %d; failed: 0; total: %d; seconds spent: 0", len(metrics), len(metrics)),
+	}
 }
 
 func LoadHostsFromFile(filename string) (map[string]string, error) {
@@ -1,12 +1,19 @@
 package zabbixsvc_test
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/devopyio/zabbix-alertmanager/itemvalue"
 	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsnd"
 	"github.com/devopyio/zabbix-alertmanager/zabbixsender/zabbixsvc"
 	log "github.com/sirupsen/logrus"
@@ -186,6 +193,40 @@ func TestJSONHandlerOK(t *testing.T) {
 	}
 }
 
+func TestRetryCanceled(t *testing.T) {
+	// nothing listens on the address of the closed listener
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	s, err := zabbixsnd.New(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &zabbixsvc.JSONHandler{
+		Sender:       s,
+		DefaultHost:  "host",
+		Retries:      3,
+		RetryBackoff: time.Hour,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	h.HandlePost(rr, httptest.NewRequest("POST", "/", strings.NewReader(alertOK)).WithContext(ctx))
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected failed send, got %d", rr.Code)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Expected retries to stop with the request, took %s", elapsed)
+	}
+}
+
 func TestJSONHandlerStatusBadRequest(t *testing.T) {
 	s, err := zabbixsnd.New("127.0.0.1:3000")
 	if err != nil {
@@ -280,3 +321,208 @@ func TestJSONHandlerInternal(t *testing.T) {
 	}
 
 }
+
+// fakeZabbix starts a trapper which answers every packet with the given info
+// and forwards the received packets to the returned channel.
+func fakeZabbix(t *testing.T, info string) (*zabbixsnd.Sender, <-chan *zabbixsnd.Packet) {
+	return fakeZabbixFunc(t, func(*zabbixsnd.Packet) string { return info })
+}
+
+// fakeZabbixFunc starts a trapper which answers every packet with the info returned by info.
+func fakeZabbixFunc(t *testing.T, info func(*zabbixsnd.Packet) string) (*zabbixsnd.Sender, <-chan *zabbixsnd.Packet) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	packets := make(chan *zabbixsnd.Packet, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			header := make([]byte, 13)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				t.Error(err)
+				conn.Close()
+				return
+			}
+
+			data := make([]byte, binary.LittleEndian.Uint32(header[5:]))
+			if _, err := io.ReadFull(conn, data); err != nil {
+				t.Error(err)
+				conn.Close()
+				return
+			}
+
+			var p zabbixsnd.Packet
+			if err := json.Unmarshal(data, &p); err != nil {
+				t.Error(err)
+			}
+			packets <- &p
+
+			res := fmt.Sprintf(`{"response":"success","info":"%s"}`, info(&p))
+			conn.Write(append(append([]byte("ZBXD\x01"), make([]byte, 8)...), res...))
+			conn.Close()
+		}
+	}()
+
+	s, err := zabbixsnd.New(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, packets
+}
+
+func TestJSONHandlerDryRun(t *testing.T) {
+	h := &zabbixsvc.JSONHandler{
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		State:       zabbixsvc.NewState(),
+		DryRun:      true,
+	}
+
+	rr := httptest.NewRecorder()
+	h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(alertInternal)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code)
+	}
+
+	entries := h.State.List("host", "prometheus.instancedown")
+	if len(entries) != 1 || entries[0].Value != "1" {
+		t.Fatalf("Expected dry run metric to be recorded, got %+v", entries)
+	}
+	if entries[0].Result.Response != "dry run" {
+		t.Fatalf("Expected dry run result, got %+v", entries[0].Result)
+	}
+}
+
+func TestJSONHandlerSkipsPulledAlerts(t *testing.T) {
+	h := &zabbixsvc.JSONHandler{
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		State:       zabbixsvc.NewState(),
+		DryRun:      true,
+	}
+
+	req := `{
+		"status": "firing",
+		"receiver": "testing",
+		"commonLabels": {"alertname": "HighCPU"},
+		"alerts": [
+			{"status": "firing", "labels": {"alertname": "HighCPU"}},
+			{"status": "firing", "labels": {"alertname": "DiskFull", "zal_source": "zabbix"}}
+		]
+	}`
+
+	rr := httptest.NewRecorder()
+	h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(req)))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Expected working, got error:", rr.Code)
+	}
+
+	if entries := h.State.List("host", ""); len(entries) != 1 || entries[0].Key != "prometheus.highcpu" {
+		t.Fatalf("Expected only alert not pulled from zabbix to be sent, got %+v", entries)
+	}
+}
+
+func TestJSONHandlerResult(t *testing.T) {
+	for _, tc := range []struct {
+		info   string
+		code   int
+		status string
+		failed int
+	}{
+		{info: "processed: 1; failed: 0; total: 1; seconds spent: 0.000041", code: http.StatusOK, status: "success"},
+		{info: "processed: 0; failed: 1; total: 1; seconds spent: 0.000041", code: http.StatusInternalServerError, status: "error", failed: 1},
+	} {
+		s, _ := fakeZabbix(t, tc.info)
+		h := &zabbixsvc.JSONHandler{
+			Sender:      s,
+			KeyPrefix:   "prometheus",
+			DefaultHost: "host",
+		}
+
+		rr := httptest.NewRecorder()
+		h.HandlePost(rr, httptest.NewRequest("POST", "/alerts", strings.NewReader(alertInternal)))
+		if rr.Code != tc.code {
+			t.Fatalf("Expected %d, got %d", tc.code, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("Expected json response, got %s", ct)
+		}
+
+		var res zabbixsvc.SendResult
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != tc.status || res.Info != tc.info || res.Failed != tc.failed || res.Total != 1 {
+			t.Fatalf("Unexpected result: %+v", res)
+		}
+		if len(res.Metrics) != 1 || res.Metrics[0].Host != "host" || res.Metrics[0].Key != "prometheus.instancedown" || res.Metrics[0].Value != "1" || res.Metrics[0].Clock == 0 {
+			t.Fatalf("Unexpected metrics: %+v", res.Metrics)
+		}
+		if tc.status == "error" && res.Error == "" {
+			t.Fatalf("Expected error message, got %+v", res)
+		}
+	}
+}
+
+func TestJSONHandlerEncodings(t *testing.T) {
+	h := &zabbixsvc.JSONHandler{
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		Hosts:       map[string]string{"testing": "web1"},
+		Encoding:    "string",
+		Encodings:   map[string]string{"host": "severity"},
+		State:       zabbixsvc.NewState(),
+		DryRun:      true,
+	}
+
+	h.HandlePost(httptest.NewRecorder(), httptest.NewRequest("POST", "/alerts", strings.NewReader(alertInternal)))
+	if entries := h.State.List("web1", ""); len(entries) != 1 || entries[0].Value != "PROBLEM" {
+		t.Fatalf("Expected default string encoding, got %+v", entries)
+	}
+
+	h.Hosts = nil
+	h.HandlePost(httptest.NewRecorder(), httptest.NewRequest("POST", "/alerts", strings.NewReader(alertInternal)))
+	if entries := h.State.List("host", ""); len(entries) != 1 || entries[0].Value != "5" {
+		t.Fatalf("Expected critical severity of host encoding, got %+v", entries)
+	}
+}
+
+func TestJSONHandlerSamples(t *testing.T) {
+	h := &zabbixsvc.JSONHandler{
+		KeyPrefix:   "prometheus",
+		DefaultHost: "host",
+		Samples:     itemvalue.SampleConfig{Annotation: "value"},
+		State:       zabbixsvc.NewState(),
+		DryRun:      true,
+	}
+
+	body := strings.Replace(alertInternal, `"summary":"Instance localhost:9100 down"
+			  }`, `"summary":"Instance localhost:9100 down", "value":"0.93"
+			  }`, 1)
+
+	h.HandlePost(httptest.NewRecorder(), httptest.NewRequest("POST", "/alerts", strings.NewReader(body)))
+
+	values := map[string]string{}
+	for _, e := range h.State.List("host", "") {
+		values[e.Key] = e.Value
+	}
+	if len(values) != 2 || values["prometheus.instancedown"] != "1" || values["prometheus.instancedown.value"] != "0.93" {
+		t.Fatalf("Expected alert and sample values, got %v", values)
+	}
+
+	// resolved alerts don't send samples
+	h.State = zabbixsvc.NewState()
+	h.HandlePost(httptest.NewRecorder(), httptest.NewRequest("POST", "/alerts", strings.NewReader(strings.Replace(body, `"status":"firing"`, `"status":"resolved"`, 1))))
+	if entries := h.State.List("host", ""); len(entries) != 1 {
+		t.Fatalf("Expected only the alert value of resolved alert, got %+v", entries)
+	}
+}